@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/dhaifley/dapi/lib"
 	"github.com/dhaifley/dlib"
 	"github.com/dhaifley/dlib/dauth"
 	"github.com/dhaifley/dlib/ptypes"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 // RESTClient values are used to communicate with REST APIs.
@@ -175,6 +177,27 @@ func (rpc *RPCClient) Close() error {
 	return rpc.Conn.Close()
 }
 
+// SetMetadata attaches request metadata to the calls made by the RPC client.
+// Empty values are not attached.
+func (rpc *RPCClient) SetMetadata(requestID, clientIP, user string) {
+	kv := []string{}
+	if requestID != "" {
+		kv = append(kv, lib.MetadataRequestID, requestID)
+	}
+
+	if clientIP != "" {
+		kv = append(kv, lib.MetadataClientIP, clientIP)
+	}
+
+	if user != "" {
+		kv = append(kv, lib.MetadataUser, user)
+	}
+
+	if len(kv) != 0 {
+		rpc.Context = metadata.AppendToOutgoingContext(rpc.Context, kv...)
+	}
+}
+
 // Login obtains an authorization token for the RPC client.
 func (rpc *RPCClient) Login(user *dauth.User) <-chan *dlib.Result {
 	rpc.User = user
@@ -7,7 +7,9 @@ import (
 	"net/url"
 	"testing"
 
+	"github.com/dhaifley/dapi/lib"
 	"github.com/dhaifley/dlib/dauth"
+	"google.golang.org/grpc/metadata"
 )
 
 // The certificate and key data in this file was created for testing purposes
@@ -106,3 +108,33 @@ func TestRPCClientLoginLogout(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRPCClientSetMetadata(t *testing.T) {
+	rpc, err := NewRPCClient("test", "test", testCrt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rpc.Close()
+	rpc.SetMetadata("test", "10.0.0.1", "")
+	md, ok := metadata.FromOutgoingContext(rpc.Context)
+	if !ok {
+		t.Fatal("No outgoing metadata attached")
+	}
+
+	cases := []struct {
+		key string
+		exp []string
+	}{
+		{key: lib.MetadataRequestID, exp: []string{"test"}},
+		{key: lib.MetadataClientIP, exp: []string{"10.0.0.1"}},
+		{key: lib.MetadataUser, exp: nil},
+	}
+
+	for _, c := range cases {
+		got := md.Get(c.key)
+		if len(got) != len(c.exp) || (len(got) > 0 && got[0] != c.exp[0]) {
+			t.Errorf("Metadata %v expected: %v, got: %v", c.key, c.exp, got)
+		}
+	}
+}
@@ -4,6 +4,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/dhaifley/dapi/lib"
 	"github.com/spf13/cobra"
@@ -37,6 +38,201 @@ func init() {
 	if err := viper.BindEnv("token"); err != nil {
 		fmt.Println(err)
 	}
+
+	viper.SetDefault("addr", ":3611")
+	if err := viper.BindEnv("addr"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("read_timeout", 30*time.Second)
+	if err := viper.BindEnv("read_timeout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("write_timeout", 60*time.Second)
+	if err := viper.BindEnv("write_timeout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("idle_timeout", 120*time.Second)
+	if err := viper.BindEnv("idle_timeout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("shutdown_timeout", 30*time.Second)
+	if err := viper.BindEnv("shutdown_timeout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("dauth_timeout", 30*time.Second)
+	if err := viper.BindEnv("dauth_timeout"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("retry_max_attempts", 4)
+	if err := viper.BindEnv("retry_max_attempts"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("retry_base_delay", 50*time.Millisecond)
+	if err := viper.BindEnv("retry_base_delay"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("retry_max_delay", 2*time.Second)
+	if err := viper.BindEnv("retry_max_delay"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("retry_budget_ratio", 0.2)
+	if err := viper.BindEnv("retry_budget_ratio"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("breaker_threshold", 5)
+	if err := viper.BindEnv("breaker_threshold"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("breaker_cooldown", 10*time.Second)
+	if err := viper.BindEnv("breaker_cooldown"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_ttl", 30*time.Second)
+	if err := viper.BindEnv("auth_cache_ttl"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_negative_ttl", 5*time.Second)
+	if err := viper.BindEnv("auth_cache_negative_ttl"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("auth_cache_size", 10000)
+	if err := viper.BindEnv("auth_cache_size"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("access_log", true)
+	if err := viper.BindEnv("access_log"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("metrics", false)
+	if err := viper.BindEnv("metrics"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("metrics_addr", "")
+	if err := viper.BindEnv("metrics_addr"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_exporter", "")
+	if err := viper.BindEnv("trace_exporter"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_endpoint", "")
+	if err := viper.BindEnv("trace_endpoint"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_insecure", false)
+	if err := viper.BindEnv("trace_insecure"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("trace_file", "dapi_traces.json")
+	if err := viper.BindEnv("trace_file"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("ready_probe", false)
+	if err := viper.BindEnv("ready_probe"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("rate_limit", 50.0)
+	if err := viper.BindEnv("rate_limit"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("rate_burst", 100)
+	if err := viper.BindEnv("rate_burst"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_rate_limit", 0.2)
+	if err := viper.BindEnv("login_rate_limit"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("login_rate_burst", 5)
+	if err := viper.BindEnv("login_rate_burst"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("cors_origins", "")
+	if err := viper.BindEnv("cors_origins"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("cors_methods", "GET,POST,PUT,PATCH,DELETE")
+	if err := viper.BindEnv("cors_methods"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("cors_headers", "Accept,Authorization,Content-Type,Token,X-Request-ID,If-Match,If-None-Match,If-Modified-Since")
+	if err := viper.BindEnv("cors_headers"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("cors_max_age", 10*time.Minute)
+	if err := viper.BindEnv("cors_max_age"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("cors_credentials", false)
+	if err := viper.BindEnv("cors_credentials"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("page_limit", 0)
+	if err := viper.BindEnv("page_limit"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("max_page_limit", 1000)
+	if err := viper.BindEnv("max_page_limit"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("max_body_size", 1<<20)
+	if err := viper.BindEnv("max_body_size"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("routes_file", "")
+	if err := viper.BindEnv("routes_file"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("tls_cert", "")
+	if err := viper.BindEnv("tls_cert"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("tls_key", "")
+	if err := viper.BindEnv("tls_key"); err != nil {
+		fmt.Println(err)
+	}
+
+	viper.SetDefault("tls_client_ca", "")
+	if err := viper.BindEnv("tls_client_ca"); err != nil {
+		fmt.Println(err)
+	}
 }
 
 // Execute starts the command processor.
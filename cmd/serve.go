@@ -1,9 +1,13 @@
 package cmd
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/dhaifley/dapi/server"
 	"github.com/dhaifley/dlib"
@@ -21,26 +25,248 @@ func init() {
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Starts the application server",
-	Long:  "The serve command starts the application server.",
-	Run: func(cmd *cobra.Command, args []string) {
-		s := server.Server{Log: logrus.New()}
+	Long: "The serve command starts the application server. If a listener " +
+		"fails the server is shut down and the error is returned.",
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s := server.Server{
+			Log:              logrus.New(),
+			Timeout:          viper.GetDuration("dauth_timeout"),
+			PageLimit:        viper.GetInt("page_limit"),
+			MaxPageLimit:     viper.GetInt("max_page_limit"),
+			MaxBodySize:      viper.GetInt64("max_body_size"),
+			RoutesFile:       viper.GetString("routes_file"),
+			DisableAccessLog: !viper.GetBool("access_log"),
+		}
+
 		s.Log.(*logrus.Logger).Out = os.Stdout
 		s.Log.(*logrus.Logger).Formatter = new(logrus.JSONFormatter)
-		var opts []grpc.DialOption
+		opts := []grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(server.UnaryClientInterceptor),
+			grpc.WithChainStreamInterceptor(server.StreamClientInterceptor),
+		}
+
 		creds, err := dlib.GetGRPCClientCredentials(viper.GetString("cert"))
 		if err != nil {
-			log.Fatalf("Failed to create client TLS credentials: %v", err)
+			return fmt.Errorf("failed to create client TLS credentials: %v", err)
+		}
+
+		if viper.GetBool("metrics") {
+			s.Metrics = server.NewMetrics()
+			s.SeparateMetrics = viper.GetString("metrics_addr") != ""
+			opts = append(opts,
+				grpc.WithChainUnaryInterceptor(s.Metrics.UnaryClientInterceptor),
+				grpc.WithChainStreamInterceptor(s.Metrics.StreamClientInterceptor))
 		}
 
-		opts = append(opts, grpc.WithTransportCredentials(creds))
-		conn, err := grpc.Dial(viper.GetString("auth_url"), opts...)
+		if viper.GetString("trace_exporter") != "" {
+			tp, shutdown, err := server.NewTracerProvider(context.Background(),
+				server.TraceConfig{
+					Exporter: viper.GetString("trace_exporter"),
+					Endpoint: viper.GetString("trace_endpoint"),
+					Insecure: viper.GetBool("trace_insecure"),
+					Path:     viper.GetString("trace_file"),
+				})
+			if err != nil {
+				return fmt.Errorf("failed to create trace exporter: %v", err)
+			}
+
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(),
+					viper.GetDuration("shutdown_timeout"))
+				defer cancel()
+				if err := shutdown(ctx); err != nil {
+					s.Log.Error(err)
+				}
+			}()
+
+			s.Tracing = tp
+			opts = append(opts,
+				grpc.WithChainUnaryInterceptor(s.TraceUnaryClientInterceptor),
+				grpc.WithChainStreamInterceptor(s.TraceStreamClientInterceptor))
+		}
+
+		conn, err := grpc.Dial(viper.GetString("auth_url"),
+			append(opts, grpc.WithTransportCredentials(creds))...)
 		if err != nil {
-			s.Log.Fatal(err)
+			return fmt.Errorf("failed to connect to dauth: %v", err)
+		}
+
+		defer func() {
+			if err := conn.Close(); err != nil {
+				s.Log.Error(err)
+			}
+		}()
+
+		var backends []server.BackendConfig
+		if err := viper.UnmarshalKey("backends", &backends); err != nil {
+			return fmt.Errorf("failed to read backend configuration: %v", err)
+		}
+
+		for _, bc := range backends {
+			b, err := server.DialBackend(bc, opts...)
+			if err != nil {
+				return fmt.Errorf("failed to initialize backend %s: %v", bc.Name, err)
+			}
+
+			defer func() {
+				if err := b.Close(); err != nil {
+					s.Log.Error(err)
+				}
+			}()
+
+			s.Backends = append(s.Backends, b)
 		}
 
-		defer conn.Close()
 		s.Auth = ptypes.NewAuthClient(conn)
-		s.InitRouter()
-		s.Log.Fatal(http.ListenAndServe(":3611", s.Router))
+		s.AuthConn = conn
+		s.ReadyProbe = viper.GetBool("ready_probe")
+		s.Retry = server.NewRetryPolicy()
+		s.Retry.MaxAttempts = viper.GetInt("retry_max_attempts")
+		s.Retry.BaseDelay = viper.GetDuration("retry_base_delay")
+		s.Retry.MaxDelay = viper.GetDuration("retry_max_delay")
+		s.Retry.Budget.Ratio = viper.GetFloat64("retry_budget_ratio")
+		s.Breaker = server.NewBreaker(viper.GetInt("breaker_threshold"),
+			viper.GetDuration("breaker_cooldown"))
+		if viper.GetDuration("auth_cache_ttl") > 0 {
+			s.AuthCache = server.NewAuthCache(viper.GetDuration("auth_cache_ttl"),
+				viper.GetDuration("auth_cache_negative_ttl"),
+				viper.GetInt("auth_cache_size"))
+			if s.Metrics != nil {
+				s.Metrics.RegisterAuthCache(s.AuthCache)
+			}
+		}
+
+		s.Limiter = server.NewRateLimiter(
+			server.RateLimit{
+				Rate:  viper.GetFloat64("rate_limit"),
+				Burst: viper.GetInt("rate_burst"),
+			},
+			server.RateLimit{
+				Rate:  viper.GetFloat64("login_rate_limit"),
+				Burst: viper.GetInt("login_rate_burst"),
+			})
+		if origins := splitList(viper.GetString("cors_origins")); len(origins) > 0 {
+			s.CORSConfig = server.NewCORSConfig(origins...)
+			s.CORSConfig.AllowedMethods = splitList(viper.GetString("cors_methods"))
+			s.CORSConfig.AllowedHeaders = splitList(viper.GetString("cors_headers"))
+			s.CORSConfig.MaxAge = viper.GetDuration("cors_max_age")
+			s.CORSConfig.AllowCredentials = viper.GetBool("cors_credentials")
+		}
+
+		if err := s.InitRouter(); err != nil {
+			return fmt.Errorf("failed to initialize routes: %v", err)
+		}
+
+		hs := &http.Server{
+			Addr:         viper.GetString("addr"),
+			Handler:      &s,
+			ReadTimeout:  viper.GetDuration("read_timeout"),
+			WriteTimeout: viper.GetDuration("write_timeout"),
+			IdleTimeout:  viper.GetDuration("idle_timeout"),
+		}
+
+		if viper.GetString("tls_cert") != "" {
+			cl, err := server.NewCertLoader(viper.GetString("tls_cert"),
+				viper.GetString("tls_key"), viper.GetString("tls_client_ca"))
+			if err != nil {
+				return fmt.Errorf("failed to load server TLS certificates: %v", err)
+			}
+
+			cl.Log = s.Log
+			hs.TLSConfig = cl.TLSConfig()
+		}
+
+		errc := make(chan error, 2)
+		go func() {
+			s.Log.WithFields(logrus.Fields{
+				"addr": hs.Addr,
+				"tls":  hs.TLSConfig != nil,
+			}).Info("Server listening")
+			if hs.TLSConfig != nil {
+				errc <- hs.ListenAndServeTLS("", "")
+				return
+			}
+
+			errc <- hs.ListenAndServe()
+		}()
+
+		var admin *http.Server
+		if s.Metrics != nil && s.SeparateMetrics {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", s.Metrics.Handler())
+			mux.HandleFunc("/healthz", s.GetHealth)
+			mux.HandleFunc("/readyz", s.GetReady)
+			admin = &http.Server{
+				Addr:         viper.GetString("metrics_addr"),
+				Handler:      mux,
+				ReadTimeout:  viper.GetDuration("read_timeout"),
+				WriteTimeout: viper.GetDuration("write_timeout"),
+				IdleTimeout:  viper.GetDuration("idle_timeout"),
+			}
+
+			go func() {
+				s.Log.WithField("addr", admin.Addr).Info("Admin server listening")
+				errc <- admin.ListenAndServe()
+			}()
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		var serr error
+	wait:
+		for {
+			select {
+			case err := <-errc:
+				if err != nil && err != http.ErrServerClosed {
+					s.Log.Error(err)
+					serr = err
+				}
+
+				break wait
+			case v := <-sig:
+				if v == syscall.SIGHUP {
+					if err := s.InitRouter(); err != nil {
+						s.Log.WithField("routes_file", s.RoutesFile).Error(err)
+						continue
+					}
+
+					s.Log.WithField("routes_file", s.RoutesFile).Info("Routes reloaded")
+					continue
+				}
+
+				s.Log.WithField("signal", v.String()).Info("Server shutting down")
+				break wait
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(),
+			viper.GetDuration("shutdown_timeout"))
+		defer cancel()
+		if err := hs.Shutdown(ctx); err != nil {
+			s.Log.Error(err)
+		}
+
+		if admin != nil {
+			if err := admin.Shutdown(ctx); err != nil {
+				s.Log.Error(err)
+			}
+		}
+
+		s.Log.Info("Server stopped")
+		return serr
 	},
 }
+
+// splitList splits a comma separated configuration value into its items.
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,9 @@
+package lib
+
+// Metadata keys used to forward request information to backend services
+// with each gRPC call.
+const (
+	MetadataRequestID = "x-request-id"
+	MetadataClientIP  = "x-forwarded-for"
+	MetadataUser      = "x-dapi-user"
+)
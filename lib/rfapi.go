@@ -9,6 +9,9 @@ import (
 // ServiceInfo provides information about this service.
 var ServiceInfo dlib.ServiceInfo
 
+// Services lists the backend services accessed through this service.
+var Services []string
+
 func init() {
 	ServiceInfo = dlib.ServiceInfo{
 		Name:    "dapi",
@@ -16,4 +19,6 @@ func init() {
 		Long:    "Provides a unified interface for interacting will all Royal Farms services.",
 		Version: "1.0.1",
 	}
+
+	Services = []string{"dauth", "dpos", "dsafe", "dapp", "dedi", "dscan"}
 }
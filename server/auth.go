@@ -16,7 +16,7 @@ func (s *Server) Authenticate(w http.ResponseWriter, r *http.Request) {
 	req.Token = &ptypes.TokenRequest{Token: r.URL.Query().Get("token")}
 	req.Perm = &ptypes.PermRequest{Service: r.URL.Query().Get("service"), Name: r.URL.Query().Get("name")}
 	u := dauth.User{}
-	ch := s.CheckAuth(&req)
+	ch := s.CheckAuth(r.Context(), &req)
 	for ar := range ch {
 		if ar.Err != nil {
 			s.RespondWithError(ar.Err, w, r)
@@ -48,18 +48,27 @@ func (s *Server) Authenticate(w http.ResponseWriter, r *http.Request) {
 
 // Login is the post handler for authorizing new tokens.
 func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
-	dec := json.NewDecoder(r.Body)
 	var u dauth.User
-	err := dec.Decode(&u)
+	err := s.DecodeBody(w, r, &u, LoginSchema)
 	if err != nil {
 		s.RespondWithError(err, w, r)
 		return
 	}
 
 	defer r.Body.Close()
+	if err := s.LoginLimit(r, u.User); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
 	req := u.ToRequest()
-	res, err := s.Auth.Login(context.Background(), &req)
-	if err != nil {
+	var res *ptypes.TokenResponse
+	if err := s.Call(r.Context(), func(ctx context.Context) error {
+		var err error
+		res, err = s.Auth.Login(ctx, &req)
+		return err
+	}); err != nil {
+		s.loginFailed(r, u.User, err)
 		s.RespondWithError(err, w, r)
 		return
 	}
@@ -79,9 +88,8 @@ func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
 
 // Logout is the post handeler for destroying tokens.
 func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
-	dec := json.NewDecoder(r.Body)
 	var t dauth.Token
-	err := dec.Decode(&t)
+	err := s.DecodeBody(w, r, &t, LogoutSchema)
 	if err != nil {
 		s.RespondWithError(err, w, r)
 		return
@@ -89,12 +97,17 @@ func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 	req := t.ToRequest()
-	res, err := s.Auth.Logout(context.Background(), &req)
-	if err != nil {
+	var res *ptypes.TokenResponse
+	if err := s.Call(r.Context(), func(ctx context.Context) error {
+		var err error
+		res, err = s.Auth.Logout(ctx, &req)
+		return err
+	}); err != nil {
 		s.RespondWithError(err, w, r)
 		return
 	}
 
+	s.AuthCache.InvalidateToken(t.Token)
 	tk := dauth.Token{}
 	err = tk.FromResponse(res)
 	if err != nil {
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+)
+
+// AuthCache values cache the authorization decisions made by the dauth
+// service. Allowed and denied decisions are kept for separate durations and
+// the least recently used decisions are evicted once the size is reached.
+type AuthCache struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	Size        int
+	mu          sync.Mutex
+	items       map[authKey]*list.Element
+	order       *list.List
+	hits        uint64
+	misses      uint64
+}
+
+// AuthCacheStats values contain the usage counts of an AuthCache.
+type AuthCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+type authKey struct {
+	token   string
+	service string
+	name    string
+}
+
+type authEntry struct {
+	key     authKey
+	res     *ptypes.AuthResponse
+	userID  int64
+	expires time.Time
+}
+
+// NewAuthCache creates and returns a pointer to an AuthCache value.
+func NewAuthCache(ttl, negativeTTL time.Duration, size int) *AuthCache {
+	return &AuthCache{
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		Size:        size,
+		items:       make(map[authKey]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// newAuthKey returns the cache key for an authorization request.
+func newAuthKey(req *ptypes.AuthRequest) authKey {
+	k := authKey{}
+	if req.Token != nil {
+		k.token = req.Token.Token
+	}
+
+	if req.Perm != nil {
+		k.service = req.Perm.Service
+		k.name = req.Perm.Name
+	}
+
+	return k
+}
+
+// Get returns the cached decision for an authorization request.
+func (ac *AuthCache) Get(req *ptypes.AuthRequest) (*ptypes.AuthResponse, bool) {
+	if ac == nil {
+		return nil, false
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if el, ok := ac.items[newAuthKey(req)]; ok {
+		e := el.Value.(*authEntry)
+		if time.Now().Before(e.expires) {
+			ac.order.MoveToFront(el)
+			atomic.AddUint64(&ac.hits, 1)
+			return e.res, true
+		}
+
+		ac.remove(el)
+	}
+
+	atomic.AddUint64(&ac.misses, 1)
+	return nil, false
+}
+
+// Set caches the decision for an authorization request.
+func (ac *AuthCache) Set(req *ptypes.AuthRequest, res *ptypes.AuthResponse) {
+	if ac == nil || res == nil {
+		return
+	}
+
+	ttl := ac.TTL
+	if !res.Ok {
+		ttl = ac.NegativeTTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	e := authEntry{
+		key:     newAuthKey(req),
+		res:     res,
+		expires: time.Now().Add(ttl),
+	}
+
+	if res.User != nil {
+		e.userID = res.User.ID
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if el, ok := ac.items[e.key]; ok {
+		ac.remove(el)
+	}
+
+	ac.items[e.key] = ac.order.PushFront(&e)
+	for ac.Size > 0 && ac.order.Len() > ac.Size {
+		ac.remove(ac.order.Back())
+	}
+}
+
+// remove deletes an element from the cache. The lock must be held.
+func (ac *AuthCache) remove(el *list.Element) {
+	ac.order.Remove(el)
+	delete(ac.items, el.Value.(*authEntry).key)
+}
+
+// removeFunc deletes all entries for which the function returns true.
+func (ac *AuthCache) removeFunc(fn func(e *authEntry) bool) {
+	if ac == nil {
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	for el := ac.order.Front(); el != nil; {
+		next := el.Next()
+		if fn(el.Value.(*authEntry)) {
+			ac.remove(el)
+		}
+
+		el = next
+	}
+}
+
+// InvalidateToken removes all cached decisions for a token.
+func (ac *AuthCache) InvalidateToken(token string) {
+	ac.removeFunc(func(e *authEntry) bool {
+		return e.key.token == token
+	})
+}
+
+// InvalidateUser removes all cached decisions for a user. Decisions for
+// which the user is not known are also removed.
+func (ac *AuthCache) InvalidateUser(id int64) {
+	ac.removeFunc(func(e *authEntry) bool {
+		return e.userID == id || e.userID == 0
+	})
+}
+
+// InvalidateUserPerms removes the cached decisions affected by saving or
+// deleting user permissions. Changes to existing user permissions may move
+// a permission between users, so they remove all cached decisions.
+func (ac *AuthCache) InvalidateUserPerms(vals ...dauth.UserPerm) {
+	for _, v := range vals {
+		if v.ID != 0 || v.UserID == 0 {
+			ac.Purge()
+			return
+		}
+	}
+
+	for _, v := range vals {
+		ac.InvalidateUser(v.UserID)
+	}
+}
+
+// Purge removes all cached decisions.
+func (ac *AuthCache) Purge() {
+	ac.removeFunc(func(e *authEntry) bool {
+		return true
+	})
+}
+
+// Stats returns the usage counts for the cache.
+func (ac *AuthCache) Stats() AuthCacheStats {
+	if ac == nil {
+		return AuthCacheStats{}
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	return AuthCacheStats{
+		Hits:   atomic.LoadUint64(&ac.hits),
+		Misses: atomic.LoadUint64(&ac.misses),
+		Size:   ac.order.Len(),
+	}
+}
+
+// GetAuthCache is the handler function for authorization cache statistics.
+func (s *Server) GetAuthCache(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(s.AuthCache.Stats()); err != nil {
+		s.Log.Error(err)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+type CountingAuthClient struct {
+	FakeAuthClient
+	calls int
+}
+
+func (fc *CountingAuthClient) Auth(ctx context.Context, in *ptypes.AuthRequest, opts ...grpc.CallOption) (*ptypes.AuthResponse, error) {
+	fc.calls++
+	return fc.FakeAuthClient.Auth(ctx, in, opts...)
+}
+
+func testAuthRequest(token string) *ptypes.AuthRequest {
+	return &ptypes.AuthRequest{
+		Token: &ptypes.TokenRequest{Token: token},
+		Perm:  &ptypes.PermRequest{Service: "test", Name: "test"},
+	}
+}
+
+func TestAuthCache(t *testing.T) {
+	ac := NewAuthCache(time.Minute, time.Minute, 2)
+	ac.Set(testAuthRequest("a"), &ptypes.AuthResponse{Ok: true,
+		User: &ptypes.UserResponse{ID: 1}})
+	ac.Set(testAuthRequest("b"), &ptypes.AuthResponse{Ok: false})
+	ac.Set(testAuthRequest("c"), &ptypes.AuthResponse{Ok: true,
+		User: &ptypes.UserResponse{ID: 2}})
+	cases := []struct {
+		token string
+		exp   bool
+	}{
+		{token: "a", exp: false},
+		{token: "b", exp: true},
+		{token: "c", exp: true},
+	}
+
+	for _, c := range cases {
+		if _, ok := ac.Get(testAuthRequest(c.token)); ok != c.exp {
+			t.Errorf("Cached %v expected: %v, got: %v", c.token, c.exp, ok)
+		}
+	}
+
+	ac.InvalidateToken("c")
+	if _, ok := ac.Get(testAuthRequest("c")); ok {
+		t.Errorf("Cached expected: %v, got: %v", false, ok)
+	}
+
+	ac.InvalidateUserPerms(dauth.UserPerm{UserID: 2, PermID: 1})
+	if _, ok := ac.Get(testAuthRequest("b")); ok {
+		t.Errorf("Cached expected: %v, got: %v", false, ok)
+	}
+
+	st := ac.Stats()
+	if st.Hits != 2 || st.Misses != 3 || st.Size != 0 {
+		t.Errorf("Stats expected: %v, got: %v",
+			AuthCacheStats{Hits: 2, Misses: 3}, st)
+	}
+}
+
+func TestServerAuthHandlerCache(t *testing.T) {
+	fc := CountingAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm, AuthCache: NewAuthCache(time.Minute, 0, 10)}
+	fh := FakeHandler{false}
+	h := svr.AuthHandler(fh, &dauth.Perm{Service: "test", Name: "test"})
+	cases := []struct {
+		token    string
+		expCalls int
+	}{
+		{token: "test", expCalls: 1},
+		{token: "test", expCalls: 1},
+		{token: "other", expCalls: 2},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fr.Header.Set("Token", c.token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, fr)
+		if w.Code != http.StatusOK {
+			t.Errorf("Status Code expected: %v, got: %v", http.StatusOK, w.Code)
+		}
+
+		if fc.calls != c.expCalls {
+			t.Errorf("Calls expected: %v, got: %v", c.expCalls, fc.calls)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// BackendConfig values describe a gRPC backend service. Its methods are
+// served below the route prefix, and are described by the file descriptor
+// set in the Descriptors file, as written by protoc --descriptor_set_out
+// with --include_imports. Backends which enable the gRPC reflection service
+// may set Reflection instead, and all of their methods are also served at
+// /{service}/rpc/{method}. Connections use TLS unless Insecure is set, and
+// send Token as a bearer token when it is set.
+type BackendConfig struct {
+	Name        string          `mapstructure:"name"`
+	Addr        string          `mapstructure:"addr"`
+	Prefix      string          `mapstructure:"prefix"`
+	Insecure    bool            `mapstructure:"insecure"`
+	CAFile      string          `mapstructure:"ca_file"`
+	CertFile    string          `mapstructure:"cert_file"`
+	KeyFile     string          `mapstructure:"key_file"`
+	ServerName  string          `mapstructure:"server_name"`
+	Token       string          `mapstructure:"token"`
+	Descriptors string          `mapstructure:"descriptors"`
+	Reflection  bool            `mapstructure:"reflection"`
+	Timeout     time.Duration   `mapstructure:"timeout"`
+	Methods     []BackendMethod `mapstructure:"methods"`
+}
+
+// BackendMethod values map an HTTP route to a backend RPC, which is named
+// by its full method name, such as "dpos.Sales/GetSales". The path is
+// relative to the backend prefix, and its variables set the fields of the
+// request message with the same names. Name is the permission name, which
+// defaults to the RPC method name, and Auth defaults to true.
+type BackendMethod struct {
+	RPC    string `mapstructure:"rpc"`
+	Method string `mapstructure:"method"`
+	Path   string `mapstructure:"path"`
+	Name   string `mapstructure:"name"`
+	Auth   *bool  `mapstructure:"auth"`
+}
+
+// Backend values are connections to gRPC backend services, with the methods
+// they serve.
+type Backend struct {
+	Config    BackendConfig
+	Conn      *grpc.ClientConn
+	Files     *protoregistry.Files
+	methods   []protoreflect.MethodDescriptor
+	mu        sync.RWMutex
+	reflected time.Time
+}
+
+// LoadDescriptors reads a file descriptor set.
+func LoadDescriptors(file string) (*protoregistry.Files, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	set := descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("unable to parse descriptor set %s: %v", file, err)
+	}
+
+	return protodesc.NewFiles(&set)
+}
+
+// findMethod returns the descriptor of a method, named by its full method
+// name, from a set of file descriptors.
+func findMethod(files *protoregistry.Files, name string) (protoreflect.MethodDescriptor, error) {
+	name = strings.TrimPrefix(name, "/")
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return nil, NewProblem(ErrBadRequest, fmt.Sprintf("invalid method name %q", name))
+	}
+
+	if files == nil {
+		return nil, NewProblem(ErrNotFound, fmt.Sprintf("unknown service %q", name[:i]))
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name[:i]))
+	if err != nil {
+		return nil, NewProblem(ErrNotFound, fmt.Sprintf("unknown service %q", name[:i]))
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, NewProblem(ErrNotFound, fmt.Sprintf("unknown service %q", name[:i]))
+	}
+
+	md := sd.Methods().ByName(protoreflect.Name(name[i+1:]))
+	if md == nil {
+		return nil, NewProblem(ErrNotFound, fmt.Sprintf("unknown method %q", name))
+	}
+
+	return md, nil
+}
+
+// fullMethod returns the full method name used to call a method.
+func fullMethod(md protoreflect.MethodDescriptor) string {
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+// NewBackend creates and returns a pointer to a Backend value using an
+// existing connection. The methods of the backend are checked against its
+// descriptors.
+func NewBackend(cfg BackendConfig, conn *grpc.ClientConn, files *protoregistry.Files) (*Backend, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("backend name is required")
+	}
+
+	b := Backend{Config: cfg, Conn: conn, Files: files}
+	errs := []string{}
+	for i, m := range cfg.Methods {
+		md, err := findMethod(files, m.RPC)
+		if err == nil && md.IsStreamingClient() {
+			err = errors.New("client streaming methods are not supported")
+		}
+
+		for v := range pathVars(m.Path) {
+			if err == nil {
+				_, err = findField(md.Input(), v)
+			}
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("method %d (%s): %v", i, m.RPC, err))
+			continue
+		}
+
+		b.methods = append(b.methods, md)
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid backend %s: %s", cfg.Name, strings.Join(errs, "; "))
+	}
+
+	return &b, nil
+}
+
+// tokenCredentials values send a bearer token with each call.
+type tokenCredentials struct {
+	token  string
+	secure bool
+}
+
+// GetRequestMetadata returns the authorization metadata for a call.
+func (tc tokenCredentials) GetRequestMetadata(ctx context.Context,
+	uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + tc.token}, nil
+}
+
+// RequireTransportSecurity checks whether the token requires TLS.
+func (tc tokenCredentials) RequireTransportSecurity() bool {
+	return tc.secure
+}
+
+// DialOptions returns the options used to connect to the backend.
+func (cfg BackendConfig) DialOptions() ([]grpc.DialOption, error) {
+	opts := []grpc.DialOption{}
+	if cfg.Insecure {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		tc := tls.Config{ServerName: cfg.ServerName}
+		if cfg.CAFile != "" {
+			pem, err := ioutil.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			tc.RootCAs = x509.NewCertPool()
+			if !tc.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+			}
+		}
+
+		if cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+
+			tc.Certificates = []tls.Certificate{cert}
+		}
+
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tc)))
+	}
+
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{
+			token:  cfg.Token,
+			secure: !cfg.Insecure,
+		}))
+	}
+
+	return opts, nil
+}
+
+// DialBackend connects to a backend, using its credentials and any other
+// dial options, and loads its descriptors. Backends using reflection without
+// any configured methods may not be available yet, so their descriptors are
+// read on demand when they cannot be read while connecting.
+func DialBackend(cfg BackendConfig, opts ...grpc.DialOption) (*Backend, error) {
+	if cfg.Descriptors == "" && !cfg.Reflection {
+		return nil, fmt.Errorf("backend %s requires descriptors or reflection", cfg.Name)
+	}
+
+	copts, err := cfg.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(cfg.Addr, append(copts, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var files *protoregistry.Files
+	if cfg.Descriptors != "" {
+		files, err = LoadDescriptors(cfg.Descriptors)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), reflectTimeout)
+		files, err = ReflectDescriptors(ctx, conn)
+		cancel()
+		if err != nil && len(cfg.Methods) == 0 {
+			err = nil
+		}
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	b, err := NewBackend(cfg, conn, files)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Close closes the connection to the backend.
+func (b *Backend) Close() error {
+	if b.Conn == nil {
+		return nil
+	}
+
+	return b.Conn.Close()
+}
+
+// backendRoutes returns the routes for the methods of a backend. Their
+// targets are the backend name followed by the full method name, such as
+// "dpos.dpos.Sales/GetSales". Methods without an HTTP method use POST.
+func (s *Server) backendRoutes(b *Backend) []Route {
+	routes := []Route{}
+	for i, m := range b.Config.Methods {
+		md := b.methods[i]
+		route := Route{
+			Service:     b.Config.Name,
+			Name:        m.Name,
+			Path:        b.Config.Prefix + m.Path,
+			Method:      strings.ToUpper(m.Method),
+			Auth:        m.Auth == nil || *m.Auth,
+			Timeout:     b.Config.Timeout,
+			Target:      b.Config.Name + "." + strings.TrimPrefix(fullMethod(md), "/"),
+			HandlerFunc: s.Transcode(b, md),
+		}
+
+		if route.Name == "" {
+			route.Name = string(md.Name())
+		}
+
+		if route.Method == "" {
+			route.Method = "POST"
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes
+}
+
+// BackendRoutes returns the routes for the methods of all backends, and the
+// route calling the methods of backends using reflection. That route does
+// not require authorization itself, since each request is authorized with
+// the service and method it calls.
+func (s *Server) BackendRoutes() []Route {
+	routes := []Route{}
+	reflection := false
+	for _, b := range s.Backends {
+		routes = append(routes, s.backendRoutes(b)...)
+		reflection = reflection || b.Config.Reflection
+	}
+
+	if reflection {
+		routes = append(routes, Route{
+			Service:     "dapi",
+			Name:        "CallRPC",
+			Path:        "/{service}/rpc/{method}",
+			Method:      "POST",
+			Target:      "dapi.CallRPC",
+			HandlerFunc: s.CallRPC,
+		})
+	}
+
+	return routes
+}
@@ -0,0 +1,400 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testWidgetsProto describes the widgets service used as a test backend.
+var testWidgetsProto = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("widgets.proto"),
+	Package: proto.String("test"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("Widget"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, false),
+				testField("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, false),
+				testField("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+			},
+		},
+		{
+			Name: proto.String("WidgetRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				testField("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32, false),
+				testField("tags", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, true),
+			},
+		},
+	},
+	Service: []*descriptorpb.ServiceDescriptorProto{
+		{
+			Name: proto.String("Widgets"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:       proto.String("GetWidget"),
+					InputType:  proto.String(".test.WidgetRequest"),
+					OutputType: proto.String(".test.Widget"),
+				},
+				{
+					Name:            proto.String("ListWidgets"),
+					InputType:       proto.String(".test.WidgetRequest"),
+					OutputType:      proto.String(".test.Widget"),
+					ServerStreaming: proto.Bool(true),
+				},
+				{
+					Name:       proto.String("SaveWidget"),
+					InputType:  proto.String(".test.Widget"),
+					OutputType: proto.String(".test.Widget"),
+				},
+				{
+					Name:            proto.String("SaveWidgets"),
+					InputType:       proto.String(".test.Widget"),
+					OutputType:      proto.String(".test.Widget"),
+					ClientStreaming: proto.Bool(true),
+				},
+			},
+		},
+	},
+}
+
+func testField(name string, num int32, typ descriptorpb.FieldDescriptorProto_Type,
+	repeated bool) *descriptorpb.FieldDescriptorProto {
+	label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	if repeated {
+		label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	}
+
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(num),
+		Type:     typ.Enum(),
+		Label:    label.Enum(),
+	}
+}
+
+// testWidgets returns the widgets used by the test backend.
+func testWidgets(md protoreflect.MessageDescriptor) []*dynamicpb.Message {
+	vals := []*dynamicpb.Message{}
+	for i, name := range []string{"a", "b", "c"} {
+		m := dynamicpb.NewMessage(md)
+		m.Set(md.Fields().ByName("id"), protoreflect.ValueOfInt32(int32(i+1)))
+		m.Set(md.Fields().ByName("name"), protoreflect.ValueOfString(name))
+		vals = append(vals, m)
+	}
+
+	return vals
+}
+
+// NewTestBackendServer starts an in-process gRPC server for the widgets
+// service, with the reflection service, and returns a connection to it made
+// with any other dial options.
+func NewTestBackendServer(t *testing.T, opts ...grpc.DialOption) (*grpc.ClientConn,
+	*protoregistry.Files, func()) {
+	fd, err := protodesc.NewFile(testWidgetsProto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+
+	sd := fd.Services().ByName("Widgets")
+	req := fd.Messages().ByName("WidgetRequest")
+	widget := fd.Messages().ByName("Widget")
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: string(sd.FullName()),
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{
+			{
+				MethodName: "GetWidget",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+					_ grpc.UnaryServerInterceptor) (interface{}, error) {
+					in := dynamicpb.NewMessage(req)
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+
+					id := in.Get(req.Fields().ByName("id")).Int()
+					for _, w := range testWidgets(widget) {
+						if w.Get(widget.Fields().ByName("id")).Int() == id {
+							return w, nil
+						}
+					}
+
+					return nil, status.Error(codes.NotFound, "widget not found")
+				},
+			},
+			{
+				MethodName: "SaveWidget",
+				Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+					_ grpc.UnaryServerInterceptor) (interface{}, error) {
+					in := dynamicpb.NewMessage(widget)
+					if err := dec(in); err != nil {
+						return nil, err
+					}
+
+					return in, nil
+				},
+			},
+		},
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "ListWidgets",
+				ServerStreams: true,
+				Handler: func(srv interface{}, stream grpc.ServerStream) error {
+					in := dynamicpb.NewMessage(req)
+					if err := stream.RecvMsg(in); err != nil {
+						return err
+					}
+
+					tags := in.Get(req.Fields().ByName("tags")).List()
+					for _, w := range testWidgets(widget) {
+						l := w.Mutable(widget.Fields().ByName("tags")).List()
+						for i := 0; i < tags.Len(); i++ {
+							l.Append(tags.Get(i))
+						}
+
+						if err := stream.SendMsg(w); err != nil {
+							return err
+						}
+					}
+
+					return nil
+				},
+			},
+		},
+	}, struct{}{})
+
+	rpb.RegisterServerReflectionServer(srv, reflection.NewServer(reflection.ServerOptions{
+		Services:           srv,
+		DescriptorResolver: files,
+	}))
+
+	lis := bufconn.Listen(1 << 20)
+	go srv.Serve(lis)
+	conn, err := grpc.Dial("bufnet", append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, files, func() {
+		conn.Close()
+		srv.Stop()
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	conn, files, stop := NewTestBackendServer(t)
+	defer stop()
+	cases := []struct {
+		method BackendMethod
+		expErr string
+	}{
+		{method: BackendMethod{RPC: "test.Widgets/GetWidget", Path: "/widgets/{id}"}},
+		{
+			method: BackendMethod{RPC: "test.Widgets/GetGadget"},
+			expErr: `unknown method "test.Widgets/GetGadget"`,
+		},
+		{
+			method: BackendMethod{RPC: "test.Gadgets/GetGadget"},
+			expErr: `unknown service "test.Gadgets"`,
+		},
+		{
+			method: BackendMethod{RPC: "test.Widgets/SaveWidgets"},
+			expErr: "client streaming methods are not supported",
+		},
+		{
+			method: BackendMethod{RPC: "test.Widgets/GetWidget", Path: "/widgets/{key}"},
+			expErr: "unknown field: key",
+		},
+	}
+
+	for _, c := range cases {
+		_, err := NewBackend(BackendConfig{
+			Name:    "widgets",
+			Methods: []BackendMethod{c.method},
+		}, conn, files)
+		if c.expErr == "" {
+			if err != nil {
+				t.Errorf("Error expected: %v, got: %v", nil, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.expErr) {
+			t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+		}
+	}
+}
+
+func TestServerTranscode(t *testing.T) {
+	conn, files, stop := NewTestBackendServer(t)
+	defer stop()
+	off := false
+	b, err := NewBackend(BackendConfig{
+		Name:   "widgets",
+		Prefix: "/widgets",
+		Methods: []BackendMethod{
+			{RPC: "test.Widgets/GetWidget", Method: "GET", Path: "/{id}", Auth: &off},
+			{RPC: "test.Widgets/ListWidgets", Method: "GET", Path: "", Auth: &off},
+			{RPC: "test.Widgets/SaveWidget", Method: "PUT", Path: "/{id}", Auth: &off},
+			{RPC: "test.Widgets/SaveWidget", Path: "/save"},
+		},
+	}, conn, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm, Backends: []*Backend{b}}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method  string
+		path    string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			method:  "GET",
+			path:    "/widgets/2",
+			expCode: http.StatusOK,
+			expBody: `{"id":2,"name":"b"}` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/4",
+			expCode: http.StatusNotFound,
+			expBody: `{"code":404,"message":"widget not found"}` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/x",
+			expCode: http.StatusBadRequest,
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/2?color=red",
+			expCode: http.StatusBadRequest,
+			expBody: `{"code":400,"message":"unknown field: color"}` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets?tags=x&tags=y",
+			expCode: http.StatusOK,
+			expBody: `[{"id":1,"name":"a","tags":["x","y"]},{"id":2,"name":"b","tags":["x","y"]},` +
+				`{"id":3,"name":"c","tags":["x","y"]}]` + "\n",
+		},
+		{
+			method:  "PUT",
+			path:    "/widgets/7",
+			body:    `{"id":1,"name":"g","tags":["z"]}`,
+			expCode: http.StatusOK,
+			expBody: `{"id":7,"name":"g","tags":["z"]}` + "\n",
+		},
+		{
+			method:  "PUT",
+			path:    "/widgets/7",
+			body:    `{"name":1}`,
+			expCode: http.StatusBadRequest,
+		},
+		{
+			method:  "POST",
+			path:    "/widgets/save",
+			body:    `{"name":"g"}`,
+			expCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		r, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		w := httptest.NewRecorder()
+		svr.ServeHTTP(w, r)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expBody != "" && w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+	}
+}
+
+func TestServerBackendRoutes(t *testing.T) {
+	conn, files, stop := NewTestBackendServer(t)
+	defer stop()
+	b, err := NewBackend(BackendConfig{
+		Name:   "widgets",
+		Prefix: "/widgets",
+		Methods: []BackendMethod{
+			{RPC: "test.Widgets/GetWidget", Method: "get", Path: "/{id}"},
+			{RPC: "test.Widgets/SaveWidget", Name: "Save"},
+		},
+	}, conn, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svr := Server{Backends: []*Backend{b}}
+	routes := svr.BackendRoutes()
+	exp := []Route{
+		{Service: "widgets", Name: "GetWidget", Path: "/widgets/{id}", Method: "GET",
+			Auth: true, Target: "widgets.test.Widgets/GetWidget"},
+		{Service: "widgets", Name: "Save", Path: "/widgets", Method: "POST",
+			Auth: true, Target: "widgets.test.Widgets/SaveWidget"},
+	}
+
+	if len(routes) != len(exp) {
+		t.Fatalf("Routes expected: %v, got: %v", len(exp), len(routes))
+	}
+
+	for i, e := range exp {
+		rt := routes[i]
+		if rt.Service != e.Service || rt.Name != e.Name || rt.Path != e.Path ||
+			rt.Method != e.Method || rt.Auth != e.Auth || rt.Target != e.Target {
+			t.Errorf("Route expected: %v, got: %v", e, rt)
+		}
+	}
+
+	if err := ValidateRoutes(svr.GetRoutes()); err != nil {
+		t.Error(err)
+	}
+}
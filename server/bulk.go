@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/dhaifley/dlib"
+)
+
+// BulkResult values report the outcome of saving one item of a bulk request.
+type BulkResult struct {
+	Index  int         `json:"index"`
+	Status int         `json:"status"`
+	Value  interface{} `json:"value,omitempty"`
+	Error  *dlib.Error `json:"error,omitempty"`
+}
+
+// bulkSaved returns the result for an item which was saved.
+func bulkSaved(i int, v interface{}) BulkResult {
+	return BulkResult{Index: i, Status: http.StatusOK, Value: v}
+}
+
+// bulkFailed returns the result for an item which could not be saved. A
+// stream which ends before the item is saved is reported as a bad gateway.
+func (s *Server) bulkFailed(w http.ResponseWriter, r *http.Request, i int, err error) BulkResult {
+	if err == io.EOF {
+		err = dlib.NewError(http.StatusBadGateway, "no response for item")
+	}
+
+	s.logError(err, r)
+	e := errorValue(w, err)
+	return BulkResult{Index: i, Status: e.Code, Error: e}
+}
+
+// RespondWithBulk responds with the results of a bulk save. The status is 200
+// when every item was saved and 207 when only some were. When none were saved
+// it is the status shared by the failed items, or the highest of them.
+func (s *Server) RespondWithBulk(w http.ResponseWriter, r *http.Request, noun string,
+	results []BulkResult) {
+	saved, code := 0, 0
+	for _, res := range results {
+		if res.Error == nil {
+			saved++
+			continue
+		}
+
+		if res.Status > code {
+			code = res.Status
+		}
+	}
+
+	msg := noun + " saved"
+	switch {
+	case saved == len(results):
+		code = http.StatusOK
+	case saved > 0:
+		code = http.StatusMultiStatus
+		msg = noun + " partially saved"
+	default:
+		msg = noun + " not saved"
+	}
+
+	res := dlib.Result{
+		Msg:  msg,
+		Num:  saved,
+		Data: results,
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		s.Log.Error(err)
+	}
+}
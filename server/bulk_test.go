@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+// BulkAuthSaveUsersClient values are save streams served by a fake backend.
+// With a zero window the backend replies only once the stream is closed.
+// Otherwise it replies to each user as it is received, and stops receiving
+// while window replies are unread, as HTTP/2 flow control would. The stream
+// ends with an error at the first invalid user.
+type BulkAuthSaveUsersClient struct {
+	grpc.ClientStream
+	in   chan *ptypes.UserRequest
+	out  chan *ptypes.UserResponse
+	done chan struct{}
+	err  error
+	sent int
+}
+
+func NewBulkAuthSaveUsersClient(ctx context.Context, window int) *BulkAuthSaveUsersClient {
+	x := &BulkAuthSaveUsersClient{
+		in:   make(chan *ptypes.UserRequest),
+		out:  make(chan *ptypes.UserResponse, window),
+		done: make(chan struct{}),
+	}
+
+	go x.serve(ctx, window)
+	return x
+}
+
+func (x *BulkAuthSaveUsersClient) serve(ctx context.Context, window int) {
+	defer close(x.out)
+	defer close(x.done)
+	pending := []*ptypes.UserRequest{}
+	for {
+		select {
+		case m, ok := <-x.in:
+			if !ok {
+				for _, m := range pending {
+					if !x.reply(ctx, m) {
+						return
+					}
+				}
+
+				x.err = io.EOF
+				return
+			}
+
+			if window == 0 {
+				pending = append(pending, m)
+			} else if !x.reply(ctx, m) {
+				return
+			}
+		case <-ctx.Done():
+			x.err = ctx.Err()
+			return
+		}
+	}
+}
+
+func (x *BulkAuthSaveUsersClient) reply(ctx context.Context, m *ptypes.UserRequest) bool {
+	switch m.User {
+	case "fail":
+		x.err = dlib.NewError(http.StatusBadRequest, "user invalid")
+		return false
+	case "end":
+		x.err = io.EOF
+		return false
+	}
+
+	select {
+	case x.out <- &ptypes.UserResponse{ID: m.ID, User: m.User}:
+		return true
+	case <-ctx.Done():
+		x.err = ctx.Err()
+		return false
+	}
+}
+
+func (x *BulkAuthSaveUsersClient) Send(m *ptypes.UserRequest) error {
+	select {
+	case x.in <- m:
+		x.sent++
+		return nil
+	case <-x.done:
+		return io.EOF
+	case <-time.After(time.Second):
+		return errors.New("send blocked")
+	}
+}
+
+func (x *BulkAuthSaveUsersClient) Recv() (*ptypes.UserResponse, error) {
+	if m, ok := <-x.out; ok {
+		return m, nil
+	}
+
+	return nil, x.err
+}
+
+func (x *BulkAuthSaveUsersClient) CloseSend() error {
+	close(x.in)
+	return nil
+}
+
+type BulkAuthClient struct {
+	FakeAuthClient
+	window  int
+	ctxs    []context.Context
+	streams []*BulkAuthSaveUsersClient
+}
+
+func (bc *BulkAuthClient) SaveUsers(ctx context.Context, opts ...grpc.CallOption) (ptypes.Auth_SaveUsersClient, error) {
+	x := NewBulkAuthSaveUsersClient(ctx, bc.window)
+	bc.ctxs = append(bc.ctxs, ctx)
+	bc.streams = append(bc.streams, x)
+	return x, nil
+}
+
+func TestPostUsersBulk(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	cases := []struct {
+		body      string
+		window    int
+		expCode   int
+		expMsg    string
+		expStatus []int
+		expOpens  int
+		expSent   int
+	}{
+		{
+			body:      `[{"id":1,"user":"a"},{"id":2,"user":"b"}]`,
+			expCode:   http.StatusOK,
+			expMsg:    "Users saved",
+			expStatus: []int{200, 200},
+			expOpens:  1,
+			expSent:   2,
+		},
+		{
+			body:      `[{"id":1,"user":"a"},{"id":2,"user":"fail"},{"id":3,"user":"c"}]`,
+			expCode:   http.StatusMultiStatus,
+			expMsg:    "Users partially saved",
+			expStatus: []int{200, 400, 400},
+			expOpens:  1,
+			expSent:   3,
+		},
+		{
+			body:      `[{"id":1,"user":"fail"},{"id":2,"user":"fail"}]`,
+			expCode:   http.StatusBadRequest,
+			expMsg:    "Users not saved",
+			expStatus: []int{400, 400},
+			expOpens:  1,
+			expSent:   2,
+		},
+		{
+			body:      `[{"id":1,"user":"a"},{"id":2,"user":"end"},{"id":3,"user":"c"}]`,
+			expCode:   http.StatusMultiStatus,
+			expMsg:    "Users partially saved",
+			expStatus: []int{200, 502, 502},
+			expOpens:  1,
+			expSent:   3,
+		},
+		{
+			body: `[{"id":1,"user":"a"},{"id":2,"user":"b"},{"id":3,"user":"c"},` +
+				`{"id":4,"user":"d"},{"id":5,"user":"e"}]`,
+			window:    2,
+			expCode:   http.StatusOK,
+			expMsg:    "Users saved",
+			expStatus: []int{200, 200, 200, 200, 200},
+			expOpens:  1,
+			expSent:   5,
+		},
+		{
+			body: `[{"id":1,"user":"a"},{"id":2,"user":"fail"},{"id":3,"user":"c"},` +
+				`{"id":4,"user":"d"}]`,
+			window:    1,
+			expCode:   http.StatusMultiStatus,
+			expMsg:    "Users partially saved",
+			expStatus: []int{200, 400, 400, 200},
+			expOpens:  2,
+			expSent:   3,
+		},
+	}
+
+	for _, c := range cases {
+		bc := BulkAuthClient{window: c.window}
+		svr := Server{Auth: &bc, Log: lm}
+		fr, err := http.NewRequest("POST", "/dauth/users", bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		w := httptest.NewRecorder()
+		svr.Users().Post(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		res := struct {
+			Msg  string       `json:"message"`
+			Data []BulkResult `json:"data"`
+		}{}
+
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Msg != c.expMsg {
+			t.Errorf("Message expected: %v, got: %v", c.expMsg, res.Msg)
+		}
+
+		if len(res.Data) != len(c.expStatus) {
+			t.Fatalf("Results expected: %v, got: %v", len(c.expStatus), len(res.Data))
+		}
+
+		for i, st := range c.expStatus {
+			if res.Data[i].Index != i || res.Data[i].Status != st {
+				t.Errorf("Result expected: %v %v, got: %v %v", i, st,
+					res.Data[i].Index, res.Data[i].Status)
+			}
+		}
+
+		if len(bc.streams) != c.expOpens {
+			t.Errorf("Streams opened expected: %v, got: %v", c.expOpens, len(bc.streams))
+		}
+
+		sent := 0
+		for _, x := range bc.streams {
+			sent += x.sent
+		}
+
+		if sent != c.expSent {
+			t.Errorf("Users sent expected: %v, got: %v", c.expSent, sent)
+		}
+
+		for i, ctx := range bc.ctxs {
+			if ctx.Err() == nil {
+				t.Errorf("Stream %v expected to be canceled", i)
+			}
+		}
+	}
+}
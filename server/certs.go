@@ -0,0 +1,170 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CertLoader values load the TLS server certificate, and optionally a client
+// certificate authority, from disk and reload them when the files change.
+// Reloads made when the files change are logged to Log, when it is set.
+type CertLoader struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+	Interval time.Duration
+	Log      logrus.FieldLogger
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTime  time.Time
+	checked  time.Time
+}
+
+// NewCertLoader creates and returns a pointer to a CertLoader value with the
+// certificates already loaded.
+func NewCertLoader(certFile, keyFile, caFile string) (*CertLoader, error) {
+	cl := CertLoader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		CAFile:   caFile,
+		Interval: 10 * time.Second,
+	}
+
+	if err := cl.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &cl, nil
+}
+
+// Reload reads the certificate files from disk and replaces the current
+// certificates. The current certificates are kept if any file is invalid.
+func (cl *CertLoader) Reload() error {
+	mt, err := cl.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cl.CertFile, cl.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	var pool *x509.CertPool
+	if cl.CAFile != "" {
+		pem, err := ioutil.ReadFile(cl.CAFile)
+		if err != nil {
+			return err
+		}
+
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no valid certificates found in client CA file")
+		}
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.cert = &cert
+	cl.pool = pool
+	cl.modTime = mt
+	cl.checked = time.Now()
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the files.
+func (cl *CertLoader) latestModTime() (time.Time, error) {
+	var mt time.Time
+	for _, f := range []string{cl.CertFile, cl.KeyFile, cl.CAFile} {
+		if f == "" {
+			continue
+		}
+
+		fi, err := os.Stat(f)
+		if err != nil {
+			return mt, err
+		}
+
+		if fi.ModTime().After(mt) {
+			mt = fi.ModTime()
+		}
+	}
+
+	return mt, nil
+}
+
+// check reloads the certificates if the files have changed since they were
+// last loaded. Files are checked at most once per interval.
+func (cl *CertLoader) check() {
+	cl.mu.Lock()
+	if time.Since(cl.checked) < cl.Interval {
+		cl.mu.Unlock()
+		return
+	}
+
+	cl.checked = time.Now()
+	loaded := cl.modTime
+	cl.mu.Unlock()
+	mt, err := cl.latestModTime()
+	if err != nil || !mt.After(loaded) {
+		return
+	}
+
+	// A failed reload, such as when a rotation is only partially written,
+	// keeps the current certificates and is retried on the next check.
+	err = cl.Reload()
+	if cl.Log == nil {
+		return
+	}
+
+	if err != nil {
+		cl.Log.WithField("tls_cert", cl.CertFile).Error(err)
+		return
+	}
+
+	cl.Log.WithField("tls_cert", cl.CertFile).Info("TLS certificates reloaded")
+}
+
+// Certificate returns the current server certificate.
+func (cl *CertLoader) Certificate() *tls.Certificate {
+	cl.check()
+	cl.mu.RLock()
+	defer cl.mu.RUnlock()
+	return cl.cert
+}
+
+// TLSConfig returns a TLS configuration which serves the current
+// certificates. Client certificates are required when a client CA is loaded.
+func (cl *CertLoader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cl.Certificate(), nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert := cl.Certificate()
+			cl.mu.RLock()
+			defer cl.mu.RUnlock()
+			cfg := tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+
+			if cl.pool != nil {
+				cfg.ClientCAs = cl.pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			return &cfg, nil
+		},
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func writeTestCert(t *testing.T, dir, name string, mt time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"server.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"server.key": pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}),
+		"ca.crt":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+
+	for f, b := range files {
+		fn := filepath.Join(dir, f)
+		if err := ioutil.WriteFile(fn, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(fn, mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func certName(t *testing.T, cert *tls.Certificate) string {
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Subject.CommonName
+}
+
+func TestCertLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	now := time.Now()
+	writeTestCert(t, dir, "first", now.Add(-time.Minute))
+	cl, err := NewCertLoader(filepath.Join(dir, "server.crt"),
+		filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm, hook := test.NewNullLogger()
+	cl.Log = lm
+	cl.Interval = 0
+	cases := []struct {
+		name     string
+		mt       time.Time
+		badKey   bool
+		exp      string
+		expLevel logrus.Level
+		expLog   string
+	}{
+		{
+			name: "",
+			exp:  "first",
+		},
+		{
+			name:     "second",
+			mt:       now,
+			exp:      "second",
+			expLevel: logrus.InfoLevel,
+			expLog:   "TLS certificates reloaded",
+		},
+		{
+			mt:       now.Add(time.Minute),
+			badKey:   true,
+			exp:      "second",
+			expLevel: logrus.ErrorLevel,
+			expLog:   "tls: failed to find any PEM data in key input",
+		},
+	}
+
+	for _, c := range cases {
+		hook.Reset()
+		if c.name != "" {
+			writeTestCert(t, dir, c.name, c.mt)
+		}
+
+		if c.badKey {
+			key := filepath.Join(dir, "server.key")
+			if err := ioutil.WriteFile(key, []byte("partial"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Chtimes(key, c.mt, c.mt); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cfg, err := cl.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := certName(t, &cfg.Certificates[0]); got != c.exp {
+			t.Errorf("Certificate expected: %v, got: %v", c.exp, got)
+		}
+
+		if cfg.ClientAuth != tls.RequireAndVerifyClientCert {
+			t.Errorf("ClientAuth expected: %v, got: %v",
+				tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+		}
+
+		if c.expLog == "" {
+			if len(hook.AllEntries()) != 0 {
+				t.Errorf("Log expected: %v, got: %v", nil, hook.LastEntry().Message)
+			}
+
+			continue
+		}
+
+		e := hook.LastEntry()
+		if e == nil || e.Level != c.expLevel || e.Message != c.expLog {
+			t.Errorf("Log expected: %v %v, got: %v", c.expLevel, c.expLog, e)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// CORSConfig values configure cross-origin resource sharing for browser
+// clients. An origin of "*" allows any origin, but only for requests without
+// credentials, and an origin such as "https://*.example.com" allows any
+// subdomain of example.com.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+}
+
+// NewCORSConfig creates and returns a pointer to a CORSConfig value with the
+// default methods and headers used by the API.
+func NewCORSConfig(origins ...string) *CORSConfig {
+	return &CORSConfig{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type",
+			"Token", RequestIDHeader, "If-Match", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders: []string{RequestIDHeader, "RateLimit-Limit",
+			"RateLimit-Remaining", "RateLimit-Reset", "Retry-After", "Link",
+			"X-Next-Cursor", "X-Total-Count", "ETag"},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// allowOrigin checks whether an origin is allowed.
+func (c *CORSConfig) allowOrigin(origin string) bool {
+	return c.anyOrigin() || c.listsOrigin(origin)
+}
+
+// anyOrigin checks whether any origin is allowed by an origin of "*".
+func (c *CORSConfig) anyOrigin() bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listsOrigin checks whether an origin is allowed by an origin other than "*".
+func (c *CORSConfig) listsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(o)
+		if o == origin {
+			return true
+		}
+
+		if i := strings.Index(o, "*."); i >= 0 && strings.HasPrefix(origin, o[:i]) &&
+			strings.HasSuffix(origin, o[i+1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowMethod checks whether a method is allowed.
+func (c *CORSConfig) allowMethod(method string) bool {
+	for _, m := range c.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowHeaders checks whether all of a comma separated list of request
+// headers are allowed.
+func (c *CORSConfig) allowHeaders(headers string) bool {
+	for _, h := range strings.Split(headers, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		ok := false
+		for _, ah := range c.AllowedHeaders {
+			if ah == "*" || strings.EqualFold(ah, h) {
+				ok = true
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setOrigin sets the headers allowing a response to be read by an origin.
+// Credentials are only allowed for origins which are listed, so an origin
+// allowed only by "*" can not read responses to credentialed requests.
+func (c *CORSConfig) setOrigin(w http.ResponseWriter, origin string) {
+	w.Header().Add("Vary", "Origin")
+	if c.AllowCredentials && c.listsOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		return
+	}
+
+	if c.anyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
+
+// CORS wraps a handler function with the cross-origin headers for requests
+// from allowed origins.
+func (s *Server) CORS(handler http.Handler) http.Handler {
+	if s.CORSConfig == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && s.CORSConfig.allowOrigin(origin) {
+			s.CORSConfig.setOrigin(w, origin)
+			if len(s.CORSConfig.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers",
+					strings.Join(s.CORSConfig.ExposedHeaders, ", "))
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Preflight returns the handler function for OPTIONS requests to a path
+// which is registered with the given methods.
+func (s *Server) Preflight(methods []string) http.HandlerFunc {
+	allowed := []string{}
+	for _, m := range methods {
+		if s.CORSConfig.allowMethod(m) {
+			allowed = append(allowed, m)
+		}
+	}
+
+	sort.Strings(allowed)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(append([]string{"OPTIONS"}, methods...), ", "))
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		ok := s.CORSConfig.allowOrigin(origin) &&
+			s.CORSConfig.allowHeaders(r.Header.Get("Access-Control-Request-Headers"))
+		if ok && method != "" {
+			ok = false
+			for _, m := range allowed {
+				if m == method {
+					ok = true
+					break
+				}
+			}
+		}
+
+		if !ok {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			s.RespondWithError(dlib.NewError(http.StatusForbidden,
+				"cross-origin request not allowed"), w, r)
+			return
+		}
+
+		s.CORSConfig.setOrigin(w, origin)
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+		if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+			w.Header().Set("Access-Control-Allow-Headers", h)
+		}
+
+		if s.CORSConfig.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age",
+				strconv.Itoa(int(s.CORSConfig.MaxAge.Seconds())))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
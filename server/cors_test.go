@@ -0,0 +1,194 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServerCORS(t *testing.T) {
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm,
+		CORSConfig: NewCORSConfig("https://app.example.com", "https://*.dapp.com")}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method    string
+		path      string
+		origin    string
+		reqMethod string
+		reqHeader string
+		expCode   int
+		expOrigin string
+		expMethod string
+	}{
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/users",
+			origin:    "https://app.example.com",
+			reqMethod: "POST",
+			reqHeader: "Content-Type, Authorization",
+			expCode:   http.StatusNoContent,
+			expOrigin: "https://app.example.com",
+			expMethod: "DELETE, GET, POST",
+		},
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/users/1",
+			origin:    "https://m.dapp.com",
+			reqMethod: "PUT",
+			expCode:   http.StatusNoContent,
+			expOrigin: "https://m.dapp.com",
+			expMethod: "DELETE, GET, PATCH, PUT",
+		},
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/users/1",
+			origin:    "https://app.example.com",
+			reqMethod: "PATCH",
+			reqHeader: "Content-Type, If-Match",
+			expCode:   http.StatusNoContent,
+			expOrigin: "https://app.example.com",
+			expMethod: "DELETE, GET, PATCH, PUT",
+		},
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/users",
+			origin:    "https://evil.com",
+			reqMethod: "GET",
+			expCode:   http.StatusForbidden,
+		},
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/login",
+			origin:    "https://app.example.com",
+			reqMethod: "GET",
+			expCode:   http.StatusForbidden,
+		},
+		{
+			method:    "OPTIONS",
+			path:      "/dauth/users",
+			origin:    "https://app.example.com",
+			reqMethod: "GET",
+			reqHeader: "X-Secret",
+			expCode:   http.StatusForbidden,
+		},
+		{
+			method:    "GET",
+			path:      "/",
+			origin:    "https://app.example.com",
+			expCode:   http.StatusOK,
+			expOrigin: "https://app.example.com",
+		},
+		{
+			method:  "GET",
+			path:    "/",
+			origin:  "https://evil.com",
+			expCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest(c.method, c.path, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set("Origin", c.origin)
+		if c.reqMethod != "" {
+			fr.Header.Set("Access-Control-Request-Method", c.reqMethod)
+		}
+
+		if c.reqHeader != "" {
+			fr.Header.Set("Access-Control-Request-Headers", c.reqHeader)
+		}
+
+		w := httptest.NewRecorder()
+		svr.Router.ServeHTTP(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != c.expOrigin {
+			t.Errorf("Access-Control-Allow-Origin expected: %v, got: %v", c.expOrigin, got)
+		}
+
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != c.expMethod {
+			t.Errorf("Access-Control-Allow-Methods expected: %v, got: %v", c.expMethod, got)
+		}
+	}
+}
+
+func TestServerCORSCredentials(t *testing.T) {
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	cc := NewCORSConfig("*", "https://app.example.com")
+	cc.AllowCredentials = true
+	svr := Server{Auth: &fc, Log: lm, CORSConfig: cc}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		origin    string
+		expOrigin string
+		expCreds  string
+	}{
+		{
+			origin:    "https://app.example.com",
+			expOrigin: "https://app.example.com",
+			expCreds:  "true",
+		},
+		{
+			origin:    "https://evil.com",
+			expOrigin: "*",
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set("Origin", c.origin)
+		w := httptest.NewRecorder()
+		svr.Router.ServeHTTP(w, fr)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != c.expOrigin {
+			t.Errorf("Access-Control-Allow-Origin expected: %v, got: %v", c.expOrigin, got)
+		}
+
+		if got := w.Header().Get("Access-Control-Allow-Credentials"); got != c.expCreds {
+			t.Errorf("Access-Control-Allow-Credentials expected: %v, got: %v", c.expCreds, got)
+		}
+	}
+}
+
+func TestServerCORSDisabled(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	fr, err := http.NewRequest("OPTIONS", "/dauth/users", nil)
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	fr.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	svr.Router.ServeHTTP(w, fr)
+	if w.Code == http.StatusNoContent {
+		t.Errorf("Code expected: not %v, got: %v", http.StatusNoContent, w.Code)
+	}
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin expected: %v, got: %v", "", got)
+	}
+}
@@ -0,0 +1,305 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/dhaifley/dlib"
+	"github.com/gorilla/mux"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem detail responses.
+const ProblemContentType = "application/problem+json"
+
+// ErrorTypeBase is the URI prefix of the problem types in the error catalog.
+var ErrorTypeBase = "/errors/"
+
+// ErrorInfo values describe an entry in the error catalog. Codes are stable
+// and may be relied on by clients.
+type ErrorInfo struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+}
+
+// ErrorCatalog contains the errors reported by the API, keyed by code.
+var ErrorCatalog = map[string]ErrorInfo{}
+
+// Error catalog codes.
+const (
+	ErrBadRequest           = "bad_request"
+	ErrValidation           = "validation_failed"
+	ErrOutOfRange           = "out_of_range"
+	ErrFailedPrecondition   = "failed_precondition"
+	ErrUnauthorized         = "unauthorized"
+	ErrForbidden            = "forbidden"
+	ErrNotFound             = "not_found"
+	ErrMethodNotAllowed     = "method_not_allowed"
+	ErrConflict             = "conflict"
+	ErrAlreadyExists        = "already_exists"
+	ErrAborted              = "aborted"
+	ErrPreconditionFailed   = "precondition_failed"
+	ErrPayloadTooLarge      = "payload_too_large"
+	ErrUnsupportedMediaType = "unsupported_media_type"
+	ErrRateLimited          = "rate_limited"
+	ErrResourceExhausted    = "resource_exhausted"
+	ErrClientClosed         = "client_closed_request"
+	ErrInternal             = "internal"
+	ErrNotImplemented       = "not_implemented"
+	ErrBadGateway           = "bad_gateway"
+	ErrUnavailable          = "unavailable"
+	ErrDeadlineExceeded     = "deadline_exceeded"
+)
+
+// StatusClientClosedRequest is the non-standard status used when a client
+// cancels its request.
+const StatusClientClosedRequest = 499
+
+func init() {
+	for _, info := range []ErrorInfo{
+		{ErrBadRequest, http.StatusBadRequest, "Bad request"},
+		{ErrValidation, http.StatusBadRequest, "Validation failed"},
+		{ErrOutOfRange, http.StatusBadRequest, "Value out of range"},
+		{ErrFailedPrecondition, http.StatusBadRequest, "Failed precondition"},
+		{ErrUnauthorized, http.StatusUnauthorized, "Unauthorized"},
+		{ErrForbidden, http.StatusForbidden, "Forbidden"},
+		{ErrNotFound, http.StatusNotFound, "Resource not found"},
+		{ErrMethodNotAllowed, http.StatusMethodNotAllowed, "Method not allowed"},
+		{ErrConflict, http.StatusConflict, "Conflict"},
+		{ErrAlreadyExists, http.StatusConflict, "Resource already exists"},
+		{ErrAborted, http.StatusConflict, "Operation aborted"},
+		{ErrPreconditionFailed, http.StatusPreconditionFailed, "Precondition failed"},
+		{ErrPayloadTooLarge, http.StatusRequestEntityTooLarge, "Payload too large"},
+		{ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported media type"},
+		{ErrRateLimited, http.StatusTooManyRequests, "Rate limit exceeded"},
+		{ErrResourceExhausted, http.StatusTooManyRequests, "Resource exhausted"},
+		{ErrClientClosed, StatusClientClosedRequest, "Client closed request"},
+		{ErrInternal, http.StatusInternalServerError, "Internal server error"},
+		{ErrNotImplemented, http.StatusNotImplemented, "Not implemented"},
+		{ErrBadGateway, http.StatusBadGateway, "Bad gateway"},
+		{ErrUnavailable, http.StatusServiceUnavailable, "Service unavailable"},
+		{ErrDeadlineExceeded, http.StatusGatewayTimeout, "Request deadline exceeded"},
+	} {
+		ErrorCatalog[info.Code] = info
+	}
+}
+
+// grpcErrors maps gRPC status codes to error catalog codes.
+var grpcErrors = map[codes.Code]string{
+	codes.Canceled:           ErrClientClosed,
+	codes.Unknown:            ErrInternal,
+	codes.InvalidArgument:    ErrBadRequest,
+	codes.DeadlineExceeded:   ErrDeadlineExceeded,
+	codes.NotFound:           ErrNotFound,
+	codes.AlreadyExists:      ErrAlreadyExists,
+	codes.PermissionDenied:   ErrForbidden,
+	codes.ResourceExhausted:  ErrResourceExhausted,
+	codes.FailedPrecondition: ErrFailedPrecondition,
+	codes.Aborted:            ErrAborted,
+	codes.OutOfRange:         ErrOutOfRange,
+	codes.Unimplemented:      ErrNotImplemented,
+	codes.Internal:           ErrInternal,
+	codes.Unavailable:        ErrUnavailable,
+	codes.DataLoss:           ErrInternal,
+	codes.Unauthenticated:    ErrUnauthorized,
+}
+
+// statusErrors maps HTTP status codes to error catalog codes.
+var statusErrors = map[int]string{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusMethodNotAllowed:      ErrMethodNotAllowed,
+	http.StatusConflict:              ErrConflict,
+	http.StatusPreconditionFailed:    ErrPreconditionFailed,
+	http.StatusRequestEntityTooLarge: ErrPayloadTooLarge,
+	http.StatusUnsupportedMediaType:  ErrUnsupportedMediaType,
+	http.StatusTooManyRequests:       ErrRateLimited,
+	StatusClientClosedRequest:        ErrClientClosed,
+	http.StatusInternalServerError:   ErrInternal,
+	http.StatusNotImplemented:        ErrNotImplemented,
+	http.StatusBadGateway:            ErrBadGateway,
+	http.StatusServiceUnavailable:    ErrUnavailable,
+	http.StatusGatewayTimeout:        ErrDeadlineExceeded,
+}
+
+// FieldError values describe an invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem values are RFC 7807 problem details describing an error.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem creates and returns a pointer to a Problem value for a catalog
+// code and detail message.
+func NewProblem(code, detail string) *Problem {
+	info, ok := ErrorCatalog[code]
+	if !ok {
+		info = ErrorCatalog[ErrInternal]
+	}
+
+	return &Problem{
+		Type:   ErrorTypeBase + info.Code,
+		Title:  info.Title,
+		Status: info.Status,
+		Detail: detail,
+		Code:   info.Code,
+	}
+}
+
+// Error returns the error message.
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+
+	return p.Title
+}
+
+// statusProblem returns the problem for an HTTP status code.
+func statusProblem(code int, detail string) *Problem {
+	c, ok := statusErrors[code]
+	if !ok {
+		c = ErrBadRequest
+		if code >= http.StatusInternalServerError {
+			c = ErrInternal
+		}
+	}
+
+	p := NewProblem(c, detail)
+	p.Status = code
+	return p
+}
+
+// grpcProblem returns the problem for a gRPC status, including any field
+// violations in its details. Retry information sets the Retry-After header.
+func grpcProblem(w http.ResponseWriter, st *status.Status) *Problem {
+	c, ok := grpcErrors[st.Code()]
+	if !ok {
+		c = ErrInternal
+	}
+
+	p := NewProblem(c, st.Message())
+	for _, d := range st.Details() {
+		switch v := d.(type) {
+		case *errdetails.BadRequest:
+			if p.Code == ErrBadRequest {
+				p = NewProblem(ErrValidation, st.Message())
+			}
+
+			for _, fv := range v.GetFieldViolations() {
+				p.Errors = append(p.Errors, FieldError{
+					Field:   fv.GetField(),
+					Message: fv.GetDescription(),
+				})
+			}
+		case *errdetails.RetryInfo:
+			if d := v.GetRetryDelay(); d != nil {
+				w.Header().Set("Retry-After", seconds(d.AsDuration()))
+			}
+		}
+	}
+
+	return p
+}
+
+// ToProblem returns the problem reported to clients for an error, and sets
+// any response headers describing it.
+func ToProblem(w http.ResponseWriter, err error) *Problem {
+	if err == context.DeadlineExceeded {
+		return NewProblem(ErrDeadlineExceeded, "request deadline exceeded")
+	}
+
+	if err == context.Canceled {
+		return NewProblem(ErrClientClosed, "request canceled")
+	}
+
+	switch v := err.(type) {
+	case *Problem:
+		return v
+	case *UnavailableError:
+		w.Header().Set("Retry-After", seconds(v.RetryAfter))
+		return NewProblem(ErrUnavailable, v.Error())
+	case *RateLimitError:
+		setRateLimitHeaders(w, v.Limit, 0, v.Reset)
+		w.Header().Set("Retry-After", seconds(v.RetryAfter))
+		return NewProblem(ErrRateLimited, v.Error())
+	case *dlib.Error:
+		return statusProblem(v.Code, v.Msg)
+	}
+
+	if st, ok := status.FromError(err); ok {
+		if st.Code() == codes.DeadlineExceeded {
+			return NewProblem(ErrDeadlineExceeded, "request deadline exceeded")
+		}
+
+		return grpcProblem(w, st)
+	}
+
+	return NewProblem(ErrInternal, err.Error())
+}
+
+// errorValue returns the error value and status code reported to clients for
+// an error, and sets any response headers describing it.
+func errorValue(w http.ResponseWriter, err error) *dlib.Error {
+	if v, ok := err.(*dlib.Error); ok {
+		return v
+	}
+
+	p := ToProblem(w, err)
+	return &dlib.Error{Code: p.Status, Msg: p.Error()}
+}
+
+// AcceptsProblem checks whether a request accepts problem detail responses.
+func AcceptsProblem(r *http.Request) bool {
+	return accepts(r, ProblemContentType)
+}
+
+// GetErrors is the handler function for error catalog requests.
+func (s *Server) GetErrors(w http.ResponseWriter, r *http.Request) {
+	if code, ok := mux.Vars(r)["code"]; ok {
+		info, ok := ErrorCatalog[code]
+		if !ok {
+			s.RespondNotFound(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(info); err != nil {
+			s.Log.Error(err)
+		}
+
+		return
+	}
+
+	data := []ErrorInfo{}
+	for _, info := range ErrorCatalog {
+		data = append(data, info)
+	}
+
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Code < data[j].Code
+	})
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		s.Log.Error(err)
+	}
+}
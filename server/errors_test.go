@@ -0,0 +1,149 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestServerRespondWithProblem(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	bad, err := status.New(codes.InvalidArgument, "invalid user").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "email", Description: "invalid email address"},
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	busy, err := status.New(codes.Unavailable, "dauth busy").WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(3 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		err           error
+		problem       bool
+		expCode       int
+		expBody       string
+		expProblem    string
+		expErrors     int
+		expRetryAfter string
+	}{
+		{
+			err:     status.Error(codes.NotFound, "user not found"),
+			expCode: http.StatusNotFound,
+			expBody: `{"code":404,"message":"user not found"}` + "\n",
+		},
+		{
+			err:     status.Error(codes.PermissionDenied, "denied"),
+			expCode: http.StatusForbidden,
+			expBody: `{"code":403,"message":"denied"}` + "\n",
+		},
+		{
+			err:     status.Error(codes.Unauthenticated, "no token"),
+			expCode: http.StatusUnauthorized,
+			expBody: `{"code":401,"message":"no token"}` + "\n",
+		},
+		{
+			err:        status.Error(codes.AlreadyExists, "user exists"),
+			problem:    true,
+			expCode:    http.StatusConflict,
+			expProblem: ErrAlreadyExists,
+		},
+		{
+			err:        bad.Err(),
+			problem:    true,
+			expCode:    http.StatusBadRequest,
+			expProblem: ErrValidation,
+			expErrors:  1,
+		},
+		{
+			err:           busy.Err(),
+			problem:       true,
+			expCode:       http.StatusServiceUnavailable,
+			expProblem:    ErrUnavailable,
+			expRetryAfter: "3",
+		},
+		{
+			err:        dlib.NewError(http.StatusNotFound, "resource not found"),
+			problem:    true,
+			expCode:    http.StatusNotFound,
+			expProblem: ErrNotFound,
+		},
+		{
+			err:        errors.New("failed"),
+			problem:    true,
+			expCode:    http.StatusInternalServerError,
+			expProblem: ErrInternal,
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/dauth/users/1", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		if c.problem {
+			fr.Header.Set("Accept", ProblemContentType)
+		}
+
+		fr = fr.WithContext(WithRequestInfo(fr.Context(), &RequestInfo{ID: "test"}))
+		w := httptest.NewRecorder()
+		svr.RespondWithError(c.err, w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if got := w.Header().Get("Retry-After"); got != c.expRetryAfter {
+			t.Errorf("Retry-After expected: %v, got: %v", c.expRetryAfter, got)
+		}
+
+		if !c.problem {
+			if w.Body.String() != c.expBody {
+				t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+			}
+
+			continue
+		}
+
+		if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+			t.Errorf("Content-Type expected: %v, got: %v", ProblemContentType, ct)
+		}
+
+		p := Problem{}
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+
+		if p.Code != c.expProblem || p.Type != ErrorTypeBase+c.expProblem {
+			t.Errorf("Code expected: %v, got: %v", c.expProblem, p.Code)
+		}
+
+		if p.Status != c.expCode {
+			t.Errorf("Status expected: %v, got: %v", c.expCode, p.Status)
+		}
+
+		if p.Instance != "/dauth/users/1" || p.RequestID != "test" {
+			t.Errorf("Instance expected: %v %v, got: %v %v", "/dauth/users/1", "test",
+				p.Instance, p.RequestID)
+		}
+
+		if len(p.Errors) != c.expErrors {
+			t.Errorf("Errors expected: %v, got: %v", c.expErrors, len(p.Errors))
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag returns the entity tag for an encoded response body.
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+}
+
+// matchETag checks whether an If-None-Match header value matches an entity
+// tag, using the weak comparison required for GET requests.
+func matchETag(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// notModified checks whether the client already has the current version of
+// a resource, from the If-None-Match header or, when it is not sent, from the
+// If-Modified-Since header.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return matchETag(inm, etag)
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.Truncate(time.Second).After(ims)
+}
+
+// RespondWithResource responds with an encoded resource and its ETag, and with
+// its Last-Modified time when modified is not zero. Conditional requests for
+// an unchanged resource are answered with a 304 status and no body.
+func (s *Server) RespondWithResource(w http.ResponseWriter, r *http.Request, v interface{},
+	modified time.Time) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	etag := ETag(buf.Bytes())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		s.Log.Error(err)
+	}
+}
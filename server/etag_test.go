@@ -0,0 +1,105 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServerRespondWithResource(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	v := map[string]interface{}{"id": 1, "user": "test"}
+	etag := ETag([]byte(`{"id":1,"user":"test"}` + "\n"))
+	mod := time.Date(2018, 2, 2, 10, 30, 0, 0, time.UTC)
+	cases := []struct {
+		method   string
+		header   string
+		value    string
+		modified time.Time
+		expCode  int
+		expBody  string
+		expLast  string
+	}{
+		{
+			method:  "GET",
+			expCode: http.StatusOK,
+			expBody: `{"id":1,"user":"test"}` + "\n",
+		},
+		{
+			method:  "GET",
+			header:  "If-None-Match",
+			value:   etag,
+			expCode: http.StatusNotModified,
+		},
+		{
+			method:  "GET",
+			header:  "If-None-Match",
+			value:   `"other", W/` + etag,
+			expCode: http.StatusNotModified,
+		},
+		{
+			method:  "GET",
+			header:  "If-None-Match",
+			value:   `"other"`,
+			expCode: http.StatusOK,
+			expBody: `{"id":1,"user":"test"}` + "\n",
+		},
+		{
+			method:   "GET",
+			header:   "If-Modified-Since",
+			value:    mod.Format(http.TimeFormat),
+			modified: mod.Add(500 * time.Millisecond),
+			expCode:  http.StatusNotModified,
+			expLast:  "Fri, 02 Feb 2018 10:30:00 GMT",
+		},
+		{
+			method:   "GET",
+			header:   "If-Modified-Since",
+			value:    mod.Add(-time.Hour).Format(http.TimeFormat),
+			modified: mod,
+			expCode:  http.StatusOK,
+			expBody:  `{"id":1,"user":"test"}` + "\n",
+			expLast:  "Fri, 02 Feb 2018 10:30:00 GMT",
+		},
+		{
+			method:  "PUT",
+			header:  "If-None-Match",
+			value:   etag,
+			expCode: http.StatusOK,
+			expBody: `{"id":1,"user":"test"}` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest(c.method, "/dauth/users/1", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		if c.header != "" {
+			fr.Header.Set(c.header, c.value)
+		}
+
+		w := httptest.NewRecorder()
+		svr.RespondWithResource(w, fr, v, c.modified)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("ETag expected: %v, got: %v", etag, got)
+		}
+
+		if got := w.Header().Get("Last-Modified"); got != c.expLast {
+			t.Errorf("Last-Modified expected: %v, got: %v", c.expLast, got)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// Fields values describe the JSON fields of a resource type.
+type Fields struct {
+	Names []string
+	index map[string]int
+}
+
+// NewFields creates and returns a pointer to a Fields value describing the
+// JSON fields of the type of a resource value.
+func NewFields(v interface{}) *Fields {
+	f := Fields{Names: []string{}, index: map[string]int{}}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return &f
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		f.Names = append(f.Names, name)
+		f.index[name] = i
+	}
+
+	return &f
+}
+
+// Check returns a 400 error listing the valid field names if any of the
+// field names are unknown.
+func (f *Fields) Check(names ...string) error {
+	for _, name := range names {
+		if _, ok := f.index[name]; !ok {
+			return dlib.NewError(http.StatusBadRequest, fmt.Sprintf(
+				"unknown field: %s, valid fields are: %s", name,
+				strings.Join(f.Names, ", ")))
+		}
+	}
+
+	return nil
+}
+
+// value returns the value of a field of a resource value.
+func (f *Fields) value(v interface{}, name string) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+
+		rv = rv.Elem()
+	}
+
+	return rv.Field(f.index[name])
+}
+
+// SortKey values describe a field used to sort records.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a comma separated list of sort fields, each prefixed with
+// "-" to sort in descending order.
+func ParseSort(v string) []SortKey {
+	keys := []SortKey{}
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		key := SortKey{Field: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+		if key.Field != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// ParseFields parses a comma separated list of field names.
+func ParseFields(v string) []string {
+	names := []string{}
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// compareValues compares two field values, returning a negative number, zero
+// or a positive number when a is less than, equal to or greater than b.
+// Nil values are less than any other value.
+func compareValues(a, b reflect.Value) int {
+	if !a.IsValid() || !b.IsValid() {
+		return compareOrdered(!a.IsValid() && b.IsValid(), a.IsValid() && !b.IsValid())
+	}
+
+	for a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return -1
+		case b.IsNil():
+			return 1
+		}
+
+		a, b = a.Elem(), b.Elem()
+	}
+
+	if at, ok := a.Interface().(time.Time); ok {
+		bt := b.Interface().(time.Time)
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+
+		return 0
+	}
+
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int() < b.Int(), a.Int() > b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint() < b.Uint(), a.Uint() > b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float() < b.Float(), a.Float() > b.Float())
+	case reflect.Bool:
+		return compareOrdered(!a.Bool() && b.Bool(), a.Bool() && !b.Bool())
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	}
+
+	return strings.Compare(fmt.Sprint(a.Interface()), fmt.Sprint(b.Interface()))
+}
+
+// compareOrdered returns the comparison result for a less or greater result.
+func compareOrdered(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+
+	return 0
+}
+
+// sortRecords sorts records by the sort keys of the list options.
+func (o ListOptions) sortRecords(data []interface{}) {
+	sort.SliceStable(data, func(i, j int) bool {
+		for _, key := range o.Sort {
+			c := compareValues(o.resource.value(data[i], key.Field),
+				o.resource.value(data[j], key.Field))
+			if c == 0 {
+				continue
+			}
+
+			if key.Desc {
+				return c > 0
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+}
+
+// project returns a record with only the selected fields of the list options.
+func (o ListOptions) project(v interface{}) (interface{}, error) {
+	if len(o.Fields) == 0 {
+		return v, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	res := map[string]json.RawMessage{}
+	for _, name := range o.Fields {
+		if fv, ok := all[name]; ok {
+			res[name] = fv
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dhaifley/dapi/lib"
+	"github.com/dhaifley/dlib/ptypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// Health status values.
+const (
+	HealthOK           = "ok"
+	HealthUnavailable  = "unavailable"
+	HealthUnconfigured = "unconfigured"
+)
+
+// ConnState is implemented by gRPC client connections which report their
+// connectivity state.
+type ConnState interface {
+	GetState() connectivity.State
+}
+
+// HealthStatus values describe the health of a dependency.
+type HealthStatus struct {
+	Status string `json:"status"`
+	State  string `json:"state,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport values describe the health of the server and its
+// dependencies.
+type HealthReport struct {
+	Service      string                  `json:"service"`
+	Version      string                  `json:"version"`
+	Status       string                  `json:"status"`
+	Dependencies map[string]HealthStatus `json:"dependencies,omitempty"`
+}
+
+// healthChecks returns the readiness checks for the configured dependencies,
+// keyed by service name. Each backend is checked under its name.
+func (s *Server) healthChecks() map[string]func(context.Context) HealthStatus {
+	checks := map[string]func(context.Context) HealthStatus{
+		"dauth": s.checkAuthHealth,
+	}
+
+	for _, b := range s.Backends {
+		checks[b.Config.Name] = b.checkHealth
+	}
+
+	return checks
+}
+
+// connHealth returns the health of a gRPC connection in a state. Idle
+// connections are healthy, since they connect again when they are used.
+func connHealth(state connectivity.State) HealthStatus {
+	hs := HealthStatus{Status: HealthOK, State: state.String()}
+	switch state {
+	case connectivity.Ready, connectivity.Idle:
+	default:
+		hs.Status = HealthUnavailable
+	}
+
+	return hs
+}
+
+// checkHealth checks the connection to a backend.
+func (b *Backend) checkHealth(ctx context.Context) HealthStatus {
+	if b.Conn == nil {
+		return HealthStatus{Status: HealthUnavailable, Error: "no connection"}
+	}
+
+	return connHealth(b.Conn.GetState())
+}
+
+// checkAuthHealth checks the connection to the dauth service. When the ready
+// probe is enabled a dauth call is also made, which only fails the check if
+// the service can not be reached.
+func (s *Server) checkAuthHealth(ctx context.Context) HealthStatus {
+	if s.Auth == nil {
+		return HealthStatus{Status: HealthUnavailable, Error: "no client configured"}
+	}
+
+	hs := HealthStatus{Status: HealthOK}
+	if s.AuthConn != nil {
+		if hs = connHealth(s.AuthConn.GetState()); hs.Status != HealthOK {
+			return hs
+		}
+	}
+
+	if s.ReadyProbe {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		_, err := s.Auth.Auth(ctx, &ptypes.AuthRequest{
+			Token: &ptypes.TokenRequest{},
+			Perm:  &ptypes.PermRequest{},
+		})
+
+		switch status.Code(err) {
+		case codes.Unavailable, codes.DeadlineExceeded:
+			hs.Status = HealthUnavailable
+			hs.Error = err.Error()
+		}
+	}
+
+	return hs
+}
+
+// GetHealth is the handler function for liveness requests.
+func (s *Server) GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(HealthReport{
+		Service: lib.ServiceInfo.Name,
+		Version: lib.ServiceInfo.Version,
+		Status:  HealthOK,
+	}); err != nil {
+		s.Log.Error(err)
+	}
+}
+
+// GetReady is the handler function for readiness requests. It reports the
+// health of each service in the service list and of each backend, and
+// responds with a 503 status if any configured service is unavailable.
+func (s *Server) GetReady(w http.ResponseWriter, r *http.Request) {
+	rep := HealthReport{
+		Service:      lib.ServiceInfo.Name,
+		Version:      lib.ServiceInfo.Version,
+		Status:       HealthOK,
+		Dependencies: map[string]HealthStatus{},
+	}
+
+	checks := s.healthChecks()
+	svcs := append([]string{}, lib.Services...)
+	for _, b := range s.Backends {
+		svcs = append(svcs, b.Config.Name)
+	}
+
+	for _, svc := range svcs {
+		if _, ok := rep.Dependencies[svc]; ok {
+			continue
+		}
+
+		check, ok := checks[svc]
+		if !ok {
+			rep.Dependencies[svc] = HealthStatus{Status: HealthUnconfigured}
+			continue
+		}
+
+		hs := check(r.Context())
+		if hs.Status != HealthOK {
+			rep.Status = HealthUnavailable
+		}
+
+		rep.Dependencies[svc] = hs
+	}
+
+	code := http.StatusOK
+	if rep.Status != HealthOK {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		s.Log.Error(err)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc/connectivity"
+)
+
+type FakeConnState struct {
+	state connectivity.State
+}
+
+func (fcs FakeConnState) GetState() connectivity.State {
+	return fcs.state
+}
+
+func TestServerGetHealth(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	fr, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	w := httptest.NewRecorder()
+	svr.GetHealth(w, fr)
+	if w.Code != http.StatusOK {
+		t.Errorf("Code expected: %v, got: %v", http.StatusOK, w.Code)
+	}
+}
+
+func TestServerGetReady(t *testing.T) {
+	cases := []struct {
+		state    connectivity.State
+		expCode  int
+		expDauth string
+	}{
+		{
+			state:    connectivity.Ready,
+			expCode:  http.StatusOK,
+			expDauth: HealthOK,
+		},
+		{
+			state:    connectivity.TransientFailure,
+			expCode:  http.StatusServiceUnavailable,
+			expDauth: HealthUnavailable,
+		},
+	}
+
+	for _, c := range cases {
+		fc := FakeAuthClient{}
+		lm, _ := test.NewNullLogger()
+		svr := Server{
+			Auth:       &fc,
+			Log:        lm,
+			AuthConn:   FakeConnState{state: c.state},
+			ReadyProbe: true,
+		}
+
+		fr, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		w := httptest.NewRecorder()
+		svr.GetReady(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		var rep HealthReport
+		if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+			t.Fatal(err)
+		}
+
+		if rep.Dependencies["dauth"].Status != c.expDauth {
+			t.Errorf("dauth status expected: %v, got: %v", c.expDauth,
+				rep.Dependencies["dauth"].Status)
+		}
+
+		if rep.Dependencies["dpos"].Status != HealthUnconfigured {
+			t.Errorf("dpos status expected: %v, got: %v", HealthUnconfigured,
+				rep.Dependencies["dpos"].Status)
+		}
+	}
+}
+
+func TestServerGetReadyBackends(t *testing.T) {
+	conn, _, stop := NewTestBackendServer(t)
+	defer stop()
+	closed, _, stopClosed := NewTestBackendServer(t)
+	stopClosed()
+	cases := []struct {
+		backends   []*Backend
+		expCode    int
+		expStatus  map[string]string
+		expMissing string
+	}{
+		{
+			backends: []*Backend{{Config: BackendConfig{Name: "dpos"}, Conn: conn}},
+			expCode:  http.StatusOK,
+			expStatus: map[string]string{
+				"dauth": HealthOK,
+				"dpos":  HealthOK,
+				"dsafe": HealthUnconfigured,
+			},
+			expMissing: "widgets",
+		},
+		{
+			backends: []*Backend{
+				{Config: BackendConfig{Name: "dpos"}, Conn: conn},
+				{Config: BackendConfig{Name: "widgets"}, Conn: closed},
+			},
+			expCode: http.StatusServiceUnavailable,
+			expStatus: map[string]string{
+				"dpos":    HealthOK,
+				"widgets": HealthUnavailable,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		fc := FakeAuthClient{}
+		lm, _ := test.NewNullLogger()
+		svr := Server{Auth: &fc, Log: lm, Backends: c.backends}
+		fr, err := http.NewRequest("GET", "/readyz", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		w := httptest.NewRecorder()
+		svr.GetReady(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		var rep HealthReport
+		if err := json.NewDecoder(w.Body).Decode(&rep); err != nil {
+			t.Fatal(err)
+		}
+
+		for svc, exp := range c.expStatus {
+			if rep.Dependencies[svc].Status != exp {
+				t.Errorf("%v status expected: %v, got: %v", svc, exp,
+					rep.Dependencies[svc].Status)
+			}
+		}
+
+		if _, ok := rep.Dependencies[c.expMissing]; c.expMissing != "" && ok {
+			t.Errorf("%v status not expected", c.expMissing)
+		}
+	}
+}
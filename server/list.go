@@ -0,0 +1,289 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dlib"
+)
+
+// NDJSONContentType is the media type of newline delimited JSON responses.
+const NDJSONContentType = "application/x-ndjson"
+
+// ErrorRecord values are written as the last record of a streamed response
+// when an error occurs after the response has started.
+type ErrorRecord struct {
+	Error *dlib.Error `json:"error"`
+}
+
+// ListOptions values describe the page of records requested from a list
+// endpoint, and the fields and order of the records. A zero Limit returns all
+// remaining records, and no Fields returns all fields.
+type ListOptions struct {
+	Limit    int
+	Offset   int
+	Fields   []string
+	Sort     []SortKey
+	resource *Fields
+}
+
+// EncodeCursor returns the opaque cursor for a record offset.
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+// DecodeCursor returns the record offset of an opaque cursor.
+func DecodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(b), "o:") {
+		return 0, dlib.NewError(http.StatusBadRequest, "invalid cursor value")
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), "o:"))
+	if err != nil || offset < 0 {
+		return 0, dlib.NewError(http.StatusBadRequest, "invalid cursor value")
+	}
+
+	return offset, nil
+}
+
+// ListQuery parses and removes the paging, fields and sort parameters from
+// the query values of a list request for records of the type of v. The
+// remaining values are used to filter the records. The maximum page limit
+// caps the limit a client sends, and the default page limit, but requests
+// without a limit still return every record when there is no default.
+func (s *Server) ListQuery(r *http.Request, v interface{}) (ListOptions, url.Values, error) {
+	q := r.URL.Query()
+	opts := ListOptions{Limit: s.PageLimit, resource: NewFields(v)}
+	explicit := false
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, q, dlib.NewError(http.StatusBadRequest, "invalid limit value")
+		}
+
+		opts.Limit, explicit = n, true
+	}
+
+	if s.MaxPageLimit > 0 && (opts.Limit > s.MaxPageLimit || explicit && opts.Limit == 0) {
+		opts.Limit = s.MaxPageLimit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, q, dlib.NewError(http.StatusBadRequest, "invalid offset value")
+		}
+
+		opts.Offset = n
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		n, err := DecodeCursor(v)
+		if err != nil {
+			return opts, q, err
+		}
+
+		opts.Offset = n
+	}
+
+	opts.Fields = ParseFields(q.Get("fields"))
+	if err := opts.resource.Check(opts.Fields...); err != nil {
+		return opts, q, err
+	}
+
+	opts.Sort = ParseSort(q.Get("sort"))
+	for _, key := range opts.Sort {
+		if err := opts.resource.Check(key.Field); err != nil {
+			return opts, q, err
+		}
+	}
+
+	q.Del("limit")
+	q.Del("offset")
+	q.Del("cursor")
+	q.Del("fields")
+	q.Del("sort")
+	return opts, q, nil
+}
+
+// pageLink returns the URL of the page of records starting at an offset.
+func pageLink(r *http.Request, limit, offset int) string {
+	q := r.URL.Query()
+	q.Del("offset")
+	q.Del("cursor")
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	if offset > 0 {
+		q.Set("cursor", EncodeCursor(offset))
+	}
+
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// pageLinks returns the Link header value for a page of records.
+func pageLinks(r *http.Request, opts ListOptions, more bool) string {
+	links := []string{`<` + pageLink(r, opts.Limit, 0) + `>; rel="first"`}
+	if opts.Offset > 0 && opts.Limit > 0 {
+		prev := opts.Offset - opts.Limit
+		if prev < 0 {
+			prev = 0
+		}
+
+		links = append(links, `<`+pageLink(r, opts.Limit, prev)+`>; rel="prev"`)
+	}
+
+	if more {
+		links = append(links, `<`+pageLink(r, opts.Limit, opts.Offset+opts.Limit)+`>; rel="next"`)
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// setPageTotals sets the X-Next-Cursor and X-Total-Count headers for a page of
+// records. The total is only known when the end of the records was reached,
+// and is otherwise negative.
+func setPageTotals(w http.ResponseWriter, opts ListOptions, more bool, total int) {
+	if more {
+		w.Header().Set("X-Next-Cursor", EncodeCursor(opts.Offset+opts.Limit))
+	}
+
+	if total >= 0 {
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	}
+}
+
+// AcceptsNDJSON checks whether a request accepts newline delimited JSON.
+func AcceptsNDJSON(r *http.Request) bool {
+	return accepts(r, NDJSONContentType)
+}
+
+// RespondWithList responds with a page of the records returned by next, which
+// returns io.EOF after the last record. Records before the page offset are
+// skipped, and no more records are read once the page is full. Requests which
+// accept NDJSON are streamed one record per line as the records are read.
+// Their Link header never links the next page, since it is sent before the
+// page is full, so the X-Next-Cursor trailer reports whether more records
+// follow. Sorted records are all read before the page is written.
+func (s *Server) RespondWithList(w http.ResponseWriter, r *http.Request, opts ListOptions,
+	next func() (interface{}, error)) {
+	if len(opts.Sort) > 0 {
+		all := []interface{}{}
+		for {
+			v, err := next()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				s.RespondWithError(err, w, r)
+				return
+			}
+
+			all = append(all, v)
+		}
+
+		opts.sortRecords(all)
+		next = func() (interface{}, error) {
+			if len(all) == 0 {
+				return nil, io.EOF
+			}
+
+			v := all[0]
+			all = all[1:]
+			return v, nil
+		}
+	}
+
+	stream := AcceptsNDJSON(r)
+	data := []interface{}{}
+	var enc *json.Encoder
+	n, sent, more := 0, 0, false
+	for {
+		v, err := next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil && enc != nil {
+			s.logError(err, r)
+			if err := enc.Encode(ErrorRecord{Error: errorValue(w, err)}); err != nil {
+				s.Log.Error(err)
+			}
+
+			return
+		}
+
+		if err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		n++
+		if n <= opts.Offset {
+			continue
+		}
+
+		if opts.Limit > 0 && sent+len(data) == opts.Limit {
+			more = true
+			break
+		}
+
+		if v, err = opts.project(v); err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		if !stream {
+			data = append(data, v)
+			continue
+		}
+
+		if enc == nil {
+			w.Header().Set("Content-Type", NDJSONContentType)
+			w.Header().Set("Link", pageLinks(r, opts, false))
+			w.Header().Set("Trailer", "X-Next-Cursor, X-Total-Count")
+			w.WriteHeader(http.StatusOK)
+			enc = json.NewEncoder(w)
+		}
+
+		if err := enc.Encode(v); err != nil {
+			s.Log.Error(err)
+			return
+		}
+
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		sent++
+	}
+
+	if len(data) == 0 && sent == 0 {
+		s.RespondNotFound(w, r)
+		return
+	}
+
+	total := -1
+	if !more {
+		total = n
+	}
+
+	if stream {
+		setPageTotals(w, opts, more, total)
+		return
+	}
+
+	w.Header().Set("Link", pageLinks(r, opts, more))
+	setPageTotals(w, opts, more, total)
+	s.RespondWithResource(w, r, data, time.Time{})
+}
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type ListRecord struct {
+	ID      int64      `json:"id"`
+	Name    string     `json:"name"`
+	Created *time.Time `json:"created,omitempty"`
+}
+
+func TestServerListQuery(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, MaxPageLimit: 100}
+	cases := []struct {
+		url       string
+		expLimit  int
+		expOffset int
+		expFields string
+		expSort   []SortKey
+		expVals   string
+		expErr    string
+	}{
+		{url: "/dauth/users?name=test", expVals: "name=test"},
+		{url: "/dauth/users?limit=0", expLimit: 100},
+		{url: "/dauth/users?limit=10&offset=20&name=test",
+			expLimit: 10, expOffset: 20, expVals: "name=test"},
+		{url: "/dauth/users?limit=500", expLimit: 100},
+		{url: "/dauth/users?limit=10&cursor=" + EncodeCursor(30),
+			expLimit: 10, expOffset: 30},
+		{url: "/dauth/users?fields=id,name&sort=-created,name",
+			expFields: "id,name",
+			expSort:   []SortKey{{Field: "created", Desc: true}, {Field: "name"}}},
+		{url: "/dauth/users?limit=x", expErr: "invalid limit value"},
+		{url: "/dauth/users?offset=-1", expErr: "invalid offset value"},
+		{url: "/dauth/users?cursor=bad", expErr: "invalid cursor value"},
+		{url: "/dauth/users?fields=id,pass",
+			expErr: "unknown field: pass, valid fields are: id, name, created"},
+		{url: "/dauth/users?sort=-email",
+			expErr: "unknown field: email, valid fields are: id, name, created"},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", c.url, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		opts, vals, err := svr.ListQuery(fr, ListRecord{})
+		if c.expErr != "" {
+			if err == nil || err.Error() != c.expErr {
+				t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if opts.Limit != c.expLimit {
+			t.Errorf("Limit expected: %v, got: %v", c.expLimit, opts.Limit)
+		}
+
+		if opts.Offset != c.expOffset {
+			t.Errorf("Offset expected: %v, got: %v", c.expOffset, opts.Offset)
+		}
+
+		if fields := strings.Join(opts.Fields, ","); fields != c.expFields {
+			t.Errorf("Fields expected: %v, got: %v", c.expFields, fields)
+		}
+
+		if len(opts.Sort) != len(c.expSort) {
+			t.Errorf("Sort expected: %v, got: %v", c.expSort, opts.Sort)
+		}
+
+		for i := range c.expSort {
+			if i < len(opts.Sort) && opts.Sort[i] != c.expSort[i] {
+				t.Errorf("Sort expected: %v, got: %v", c.expSort, opts.Sort)
+			}
+		}
+
+		if vals.Encode() != c.expVals {
+			t.Errorf("Values expected: %v, got: %v", c.expVals, vals.Encode())
+		}
+	}
+}
+
+func TestServerRespondWithList(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	cases := []struct {
+		opts     ListOptions
+		expCode  int
+		expBody  string
+		expRead  int
+		expNext  string
+		expTotal string
+		expLink  string
+	}{
+		{
+			opts:     ListOptions{},
+			expCode:  http.StatusOK,
+			expBody:  "[1,2,3,4,5]\n",
+			expRead:  6,
+			expTotal: "5",
+			expLink:  `</dauth/users>; rel="first"`,
+		},
+		{
+			opts:    ListOptions{Limit: 2},
+			expCode: http.StatusOK,
+			expBody: "[1,2]\n",
+			expRead: 3,
+			expNext: EncodeCursor(2),
+			expLink: `</dauth/users?limit=2>; rel="first", ` +
+				`</dauth/users?cursor=` + EncodeCursor(2) + `&limit=2>; rel="next"`,
+		},
+		{
+			opts:     ListOptions{Limit: 2, Offset: 4},
+			expCode:  http.StatusOK,
+			expBody:  "[5]\n",
+			expRead:  6,
+			expTotal: "5",
+			expLink: `</dauth/users?limit=2>; rel="first", ` +
+				`</dauth/users?cursor=` + EncodeCursor(2) + `&limit=2>; rel="prev"`,
+		},
+		{
+			opts:    ListOptions{Limit: 2, Offset: 10},
+			expCode: http.StatusNotFound,
+			expRead: 6,
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/dauth/users", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		read := 0
+		w := httptest.NewRecorder()
+		svr.RespondWithList(w, fr, c.opts, func() (interface{}, error) {
+			read++
+			if read > 5 {
+				return nil, io.EOF
+			}
+
+			return read, nil
+		})
+
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expBody != "" && w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+
+		if read != c.expRead {
+			t.Errorf("Records read expected: %v, got: %v", c.expRead, read)
+		}
+
+		if got := w.Header().Get("X-Next-Cursor"); got != c.expNext {
+			t.Errorf("X-Next-Cursor expected: %v, got: %v", c.expNext, got)
+		}
+
+		if got := w.Header().Get("X-Total-Count"); got != c.expTotal {
+			t.Errorf("X-Total-Count expected: %v, got: %v", c.expTotal, got)
+		}
+
+		if got := w.Header().Get("Link"); got != c.expLink {
+			t.Errorf("Link expected: %v, got: %v", c.expLink, got)
+		}
+	}
+}
+
+func TestServerRespondWithListNDJSON(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	cases := []struct {
+		opts     ListOptions
+		failAt   int
+		expCode  int
+		expBody  string
+		expNext  string
+		expTotal string
+	}{
+		{
+			opts:     ListOptions{},
+			expCode:  http.StatusOK,
+			expBody:  "1\n2\n3\n",
+			expTotal: "3",
+		},
+		{
+			opts:    ListOptions{Limit: 2},
+			expCode: http.StatusOK,
+			expBody: "1\n2\n",
+			expNext: EncodeCursor(2),
+		},
+		{
+			opts:    ListOptions{},
+			failAt:  3,
+			expCode: http.StatusOK,
+			expBody: "1\n2\n" + `{"error":{"code":500,"message":"stream failed"}}` + "\n",
+		},
+		{
+			opts:    ListOptions{},
+			failAt:  1,
+			expCode: http.StatusInternalServerError,
+			expBody: `{"code":500,"message":"stream failed"}` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/dauth/users", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set("Accept", "application/x-ndjson")
+		read := 0
+		w := httptest.NewRecorder()
+		svr.RespondWithList(w, fr, c.opts, func() (interface{}, error) {
+			read++
+			if read > 1 && c.expCode == http.StatusOK && !w.Flushed {
+				t.Errorf("Flushed expected: %v, got: %v", true, w.Flushed)
+			}
+
+			if read == c.failAt {
+				return nil, errors.New("stream failed")
+			}
+
+			if read > 3 {
+				return nil, io.EOF
+			}
+
+			return read, nil
+		})
+
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+
+		if got := w.Header().Get("X-Next-Cursor"); got != c.expNext {
+			t.Errorf("X-Next-Cursor expected: %v, got: %v", c.expNext, got)
+		}
+
+		if got := w.Header().Get("X-Total-Count"); got != c.expTotal {
+			t.Errorf("X-Total-Count expected: %v, got: %v", c.expTotal, got)
+		}
+	}
+}
+
+func TestServerRespondWithListFieldsSort(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm}
+	t1 := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	records := []ListRecord{
+		{ID: 1, Name: "b", Created: &t1},
+		{ID: 2, Name: "a", Created: &t2},
+		{ID: 3, Name: "c"},
+		{ID: 4, Name: "a", Created: &t1},
+	}
+
+	cases := []struct {
+		url     string
+		expBody string
+	}{
+		{
+			url:     "/dauth/users?fields=id",
+			expBody: `[{"id":1},{"id":2},{"id":3},{"id":4}]` + "\n",
+		},
+		{
+			url:     "/dauth/users?fields=id,name&sort=name,-id",
+			expBody: `[{"id":4,"name":"a"},{"id":2,"name":"a"},{"id":1,"name":"b"},{"id":3,"name":"c"}]` + "\n",
+		},
+		{
+			url:     "/dauth/users?fields=id&sort=-created,id&limit=2",
+			expBody: `[{"id":2},{"id":1}]` + "\n",
+		},
+		{
+			url:     "/dauth/users?fields=id&sort=created",
+			expBody: `[{"id":3},{"id":1},{"id":4},{"id":2}]` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", c.url, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		opts, _, err := svr.ListQuery(fr, ListRecord{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		i := 0
+		w := httptest.NewRecorder()
+		svr.RespondWithList(w, fr, opts, func() (interface{}, error) {
+			if i == len(records) {
+				return nil, io.EOF
+			}
+
+			i++
+			return records[i-1], nil
+		})
+
+		if w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+	}
+}
+
+func TestServerListQueryPageLimit(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	cases := []struct {
+		pageLimit int
+		url       string
+		expLimit  int
+	}{
+		{pageLimit: 0, url: "/dauth/users", expLimit: 0},
+		{pageLimit: 50, url: "/dauth/users", expLimit: 50},
+		{pageLimit: 500, url: "/dauth/users", expLimit: 100},
+		{pageLimit: 50, url: "/dauth/users?limit=500", expLimit: 100},
+	}
+
+	for _, c := range cases {
+		svr := Server{Log: lm, PageLimit: c.pageLimit, MaxPageLimit: 100}
+		fr, err := http.NewRequest("GET", c.url, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		opts, _, err := svr.ListQuery(fr, ListRecord{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if opts.Limit != c.expLimit {
+			t.Errorf("Limit expected: %v, got: %v", c.expLimit, opts.Limit)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"net"
+
+	"github.com/dhaifley/dapi/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// clientIP returns the IP address from a remote address.
+func clientIP(remote string) string {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+
+	return host
+}
+
+// OutgoingContext returns a copy of the context with the request ID, client
+// IP address and authenticated user of the request attached as outgoing gRPC
+// metadata.
+func OutgoingContext(ctx context.Context) context.Context {
+	ri := GetRequestInfo(ctx)
+	if ri == nil {
+		return ctx
+	}
+
+	kv := []string{}
+	if ri.ID != "" {
+		kv = append(kv, lib.MetadataRequestID, ri.ID)
+	}
+
+	if ri.Remote != "" {
+		kv = append(kv, lib.MetadataClientIP, clientIP(ri.Remote))
+	}
+
+	if ri.User != "" {
+		kv = append(kv, lib.MetadataUser, ri.User)
+	}
+
+	if len(kv) == 0 {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// UnaryClientInterceptor attaches request metadata to unary gRPC calls.
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(OutgoingContext(ctx), method, req, reply, cc, opts...)
+}
+
+// StreamClientInterceptor attaches request metadata to streaming gRPC calls.
+func StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
+	cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return streamer(OutgoingContext(ctx), desc, cc, method, opts...)
+}
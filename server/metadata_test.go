@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dhaifley/dapi/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	cases := []struct {
+		ri  *RequestInfo
+		exp map[string]string
+	}{
+		{
+			ri: &RequestInfo{ID: "test", Remote: "10.0.0.1:5000", User: "user"},
+			exp: map[string]string{
+				lib.MetadataRequestID: "test",
+				lib.MetadataClientIP:  "10.0.0.1",
+				lib.MetadataUser:      "user",
+			},
+		},
+		{
+			ri:  nil,
+			exp: map[string]string{},
+		},
+	}
+
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.ri != nil {
+			ctx = WithRequestInfo(ctx, c.ri)
+		}
+
+		var md metadata.MD
+		invoker := func(ctx context.Context, method string, req, reply interface{},
+			cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ = metadata.FromOutgoingContext(ctx)
+			return nil
+		}
+
+		if err := UnaryClientInterceptor(ctx, "/ptypes.Auth/Auth", nil, nil, nil, invoker); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(md) != len(c.exp) {
+			t.Errorf("Metadata expected: %v, got: %v", c.exp, md)
+		}
+
+		for k, v := range c.exp {
+			if got := md.Get(k); len(got) != 1 || got[0] != v {
+				t.Errorf("Metadata %v expected: %v, got: %v", k, v, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics values contain the Prometheus collectors for the server.
+type Metrics struct {
+	Registry    *prometheus.Registry
+	Requests    *prometheus.CounterVec
+	Duration    *prometheus.HistogramVec
+	InFlight    *prometheus.GaugeVec
+	AuthChecks  *prometheus.CounterVec
+	RPCRequests *prometheus.CounterVec
+	RPCDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates and returns a pointer to a Metrics value with all
+// collectors registered in a new registry.
+func NewMetrics() *Metrics {
+	m := Metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dapi",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests processed.",
+		}, []string{"route", "service", "method", "code"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "dapi",
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "service", "method"}),
+		InFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "dapi",
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests being processed.",
+		}, []string{"route", "service"}),
+		AuthChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dapi",
+			Name:      "auth_checks_total",
+			Help:      "Number of authorization checks by outcome.",
+		}, []string{"outcome", "cached"}),
+		RPCRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "dapi",
+			Name:      "grpc_client_requests_total",
+			Help:      "Number of gRPC calls made to backend services by status code.",
+		}, []string{"method", "code"}),
+		RPCDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "dapi",
+			Name:      "grpc_client_duration_seconds",
+			Help:      "Duration of gRPC calls made to backend services.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Requests,
+		m.Duration,
+		m.InFlight,
+		m.AuthChecks,
+		m.RPCRequests,
+		m.RPCDuration,
+	)
+
+	return &m
+}
+
+// RegisterAuthCache registers collectors for the authorization cache hit and
+// miss counts.
+func (m *Metrics) RegisterAuthCache(ac *AuthCache) {
+	m.Registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "dapi",
+			Name:      "auth_cache_hits_total",
+			Help:      "Number of authorization decisions served from the cache.",
+		}, func() float64 {
+			return float64(ac.Stats().Hits)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "dapi",
+			Name:      "auth_cache_misses_total",
+			Help:      "Number of authorization decisions not found in the cache.",
+		}, func() float64 {
+			return float64(ac.Stats().Misses)
+		}),
+	)
+}
+
+// Handler returns the handler which serves the metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// authCheck records the outcome of an authorization check.
+func (m *Metrics) authCheck(outcome string, cached bool) {
+	if m == nil {
+		return
+	}
+
+	m.AuthChecks.WithLabelValues(outcome, strconv.FormatBool(cached)).Inc()
+}
+
+// rpcDone records the result of a gRPC call.
+func (m *Metrics) rpcDone(method string, start time.Time, err error) {
+	m.RPCRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	m.RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// UnaryClientInterceptor records metrics for unary gRPC calls.
+func (m *Metrics) UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	m.rpcDone(method, start, err)
+	return err
+}
+
+// StreamClientInterceptor records metrics for streaming gRPC calls. Streams
+// are recorded when they finish, which includes streams abandoned by
+// canceling their context before they are read to the end.
+func (m *Metrics) StreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
+	cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	start := time.Now()
+	done := finishOnce(func(err error) {
+		m.rpcDone(method, start, err)
+	})
+
+	cs, err := streamer(ctx, desc, cc, method, append(opts, grpc.OnFinish(done))...)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// finishOnce returns a function which calls f only the first time it is
+// called, for reporting the end of a gRPC call.
+func finishOnce(f func(err error)) func(err error) {
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			f(err)
+		})
+	}
+}
+
+// Instrument wraps a handler function with request metrics for the route.
+func (s *Server) Instrument(handler http.Handler, route Route) http.Handler {
+	if s.Metrics == nil {
+		return handler
+	}
+
+	inFlight := s.Metrics.InFlight.WithLabelValues(route.Name, route.Service)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Inc()
+		defer inFlight.Dec()
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		handler.ServeHTTP(rw, r)
+		s.Metrics.Requests.WithLabelValues(route.Name, route.Service, r.Method,
+			strconv.Itoa(rw.Status())).Inc()
+		s.Metrics.Duration.WithLabelValues(route.Name, route.Service, r.Method).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// GetMetrics is the handler function for metrics requests.
+func (s *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.Metrics == nil {
+		s.RespondNotFound(w, r)
+		return
+	}
+
+	s.Metrics.Handler().ServeHTTP(w, r)
+}
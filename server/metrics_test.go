@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServerInstrument(t *testing.T) {
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm, Metrics: NewMetrics()}
+	route := Route{Service: "dauth", Name: "GetUsers"}
+	h := svr.Instrument(svr.AuthHandler(http.HandlerFunc(svr.Users().Get),
+		&dauth.Perm{Service: route.Service, Name: route.Name}), route)
+	cases := []struct {
+		token   string
+		expCode string
+	}{
+		{token: "test", expCode: "200"},
+		{token: "", expCode: "401"},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/dauth/users", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set("Token", c.token)
+		h.ServeHTTP(httptest.NewRecorder(), fr)
+		got := testutil.ToFloat64(svr.Metrics.Requests.WithLabelValues(
+			route.Name, route.Service, "GET", c.expCode))
+		if got != 1 {
+			t.Errorf("Requests with code %v expected: %v, got: %v", c.expCode, 1, got)
+		}
+	}
+
+	got := testutil.ToFloat64(svr.Metrics.AuthChecks.WithLabelValues("allowed", "false"))
+	if got != 1 {
+		t.Errorf("Allowed auth checks expected: %v, got: %v", 1, got)
+	}
+}
+
+func TestServerGetMetrics(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, Metrics: NewMetrics()}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		w       *httptest.ResponseRecorder
+		path    string
+		expCode int
+		expBody string
+	}{
+		{
+			w:       httptest.NewRecorder(),
+			path:    "/",
+			expCode: http.StatusOK,
+		},
+		{
+			w:       httptest.NewRecorder(),
+			path:    "/metrics",
+			expCode: http.StatusOK,
+			expBody: `dapi_http_requests_total{code="200",method="GET",route="index",service="dapi"} 1`,
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		svr.Router.ServeHTTP(c.w, fr)
+		if c.w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, c.w.Code)
+		}
+
+		if !strings.Contains(c.w.Body.String(), c.expBody) {
+			t.Errorf("Body expected to contain: %v, got: %v", c.expBody, c.w.Body.String())
+		}
+	}
+}
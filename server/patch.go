@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/dhaifley/dlib"
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+// Patch document media types.
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// ApplyPatch applies the JSON Merge Patch or JSON Patch document in a request
+// body to the current value of a resource, and decodes the result into v,
+// which is validated against a schema. When the request has an If-Match
+// header it must match the ETag of the current value.
+func (s *Server) ApplyPatch(w http.ResponseWriter, r *http.Request, cur, v interface{}, sc Schema) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(cur); err != nil {
+		return err
+	}
+
+	if im := r.Header.Get("If-Match"); im != "" && !matchETag(im, ETag(buf.Bytes())) {
+		return dlib.NewError(http.StatusPreconditionFailed,
+			"resource has been modified")
+	}
+
+	body, err := ioutil.ReadAll(s.limitBody(w, r))
+	if err != nil {
+		return decodeError(err)
+	}
+
+	defer r.Body.Close()
+	doc := buf.Bytes()
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case MergePatchContentType:
+		if doc, err = jsonpatch.MergePatch(doc, body); err != nil {
+			return dlib.NewError(http.StatusBadRequest,
+				"invalid merge patch: "+err.Error())
+		}
+	case JSONPatchContentType:
+		p, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return dlib.NewError(http.StatusBadRequest,
+				"invalid json patch: "+err.Error())
+		}
+
+		if doc, err = p.Apply(doc); err != nil {
+			return dlib.NewError(http.StatusConflict,
+				"unable to apply patch: "+err.Error())
+		}
+	default:
+		return dlib.NewError(http.StatusUnsupportedMediaType,
+			"patch content type must be "+MergePatchContentType+
+				" or "+JSONPatchContentType)
+	}
+
+	if err := decodeStrict(bytes.NewReader(doc), v); err != nil {
+		return err
+	}
+
+	errs, err := sc.Validate(v)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return validationProblem(errs...)
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+type PatchAuthSaveUsersClient struct {
+	grpc.ClientStream
+	sent []*ptypes.UserRequest
+	idx  int
+}
+
+func (x *PatchAuthSaveUsersClient) Send(m *ptypes.UserRequest) error {
+	x.sent = append(x.sent, m)
+	return nil
+}
+
+func (x *PatchAuthSaveUsersClient) Recv() (*ptypes.UserResponse, error) {
+	if x.idx >= len(x.sent) {
+		return nil, io.EOF
+	}
+
+	m := x.sent[x.idx]
+	x.idx++
+	return &ptypes.UserResponse{ID: m.ID, User: m.User, Pass: m.Pass,
+		Name: m.Name, Email: m.Email}, nil
+}
+
+func (x *PatchAuthSaveUsersClient) CloseSend() error {
+	return nil
+}
+
+type PatchAuthGetUsersClient struct {
+	grpc.ClientStream
+	count int
+}
+
+func (x *PatchAuthGetUsersClient) Recv() (*ptypes.UserResponse, error) {
+	x.count++
+	if x.count > 1 {
+		return nil, io.EOF
+	}
+
+	return &ptypes.UserResponse{ID: 1, User: "test", Pass: "secret",
+		Name: "Test", Email: "test@example.com"}, nil
+}
+
+type PatchAuthClient struct {
+	FakeAuthClient
+	save PatchAuthSaveUsersClient
+}
+
+func (pc *PatchAuthClient) GetUsers(ctx context.Context, in *ptypes.UserRequest, opts ...grpc.CallOption) (ptypes.Auth_GetUsersClient, error) {
+	return &PatchAuthGetUsersClient{}, nil
+}
+
+func (pc *PatchAuthClient) SaveUsers(ctx context.Context, opts ...grpc.CallOption) (ptypes.Auth_SaveUsersClient, error) {
+	return &pc.save, nil
+}
+
+func TestPatchUserByID(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	cases := []struct {
+		contentType string
+		ifMatch     string
+		body        string
+		expCode     int
+		expBody     string
+		expSaved    bool
+		expPass     string
+	}{
+		{
+			contentType: MergePatchContentType,
+			body:        `{"email":"new@example.com","id":5}`,
+			expCode:     http.StatusOK,
+			expBody:     `{"value":{"id":1,"user":"test","name":"Test","email":"new@example.com"},"number":1,"message":"User saved"}` + "\n",
+			expSaved:    true,
+		},
+		{
+			contentType: JSONPatchContentType,
+			body:        `[{"op":"replace","path":"/pass","value":"changed"}]`,
+			expCode:     http.StatusOK,
+			expBody:     `{"value":{"id":1,"user":"test","name":"Test","email":"test@example.com"},"number":1,"message":"User saved"}` + "\n",
+			expSaved:    true,
+			expPass:     "changed",
+		},
+		{
+			contentType: JSONPatchContentType,
+			body:        `[{"op":"test","path":"/name","value":"Other"}]`,
+			expCode:     http.StatusConflict,
+		},
+		{
+			contentType: JSONPatchContentType,
+			body:        `{"op":"replace"}`,
+			expCode:     http.StatusBadRequest,
+		},
+		{
+			contentType: "application/json",
+			body:        `{"email":"new@example.com"}`,
+			expCode:     http.StatusUnsupportedMediaType,
+		},
+		{
+			contentType: MergePatchContentType,
+			ifMatch:     `"stale"`,
+			body:        `{"email":"new@example.com"}`,
+			expCode:     http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, c := range cases {
+		pc := PatchAuthClient{}
+		svr := Server{Auth: &pc, Log: lm}
+		rtr := mux.NewRouter()
+		rtr.Methods("PATCH").Path("/dauth/users/{id}").HandlerFunc(svr.Users().PatchByID)
+		fr, err := http.NewRequest("PATCH", "/dauth/users/1", bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set("Content-Type", c.contentType)
+		if c.ifMatch != "" {
+			fr.Header.Set("If-Match", c.ifMatch)
+		}
+
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expBody != "" && w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+
+		if !c.expSaved {
+			if len(pc.save.sent) != 0 {
+				t.Errorf("Saved expected: %v, got: %v", 0, len(pc.save.sent))
+			}
+
+			continue
+		}
+
+		if len(pc.save.sent) != 1 {
+			t.Fatalf("Saved expected: %v, got: %v", 1, len(pc.save.sent))
+		}
+
+		if pc.save.sent[0].Pass != c.expPass {
+			t.Errorf("Pass expected: %v, got: %v", c.expPass, pc.save.sent[0].Pass)
+		}
+	}
+}
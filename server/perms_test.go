@@ -20,7 +20,7 @@ func TestServerGetPerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/perms").HandlerFunc(svr.GetPerms)
+	rtr.Methods("GET").Path("/dauth/perms").HandlerFunc(svr.Perms().Get)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -58,7 +58,7 @@ func TestGetPermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/perms/{id}").HandlerFunc(svr.GetPermByID)
+	rtr.Methods("GET").Path("/dauth/perms/{id}").HandlerFunc(svr.Perms().GetByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -87,7 +87,7 @@ func TestGetPermByID(t *testing.T) {
 }
 
 func TestPostPerms(t *testing.T) {
-	jbs := []byte("[{\"id\":1}]\n")
+	jbs := []byte("[{\"id\":1,\"service\":\"test\",\"name\":\"test\"}]\n")
 	fr, err := http.NewRequest("POST", "/dauth/perms", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -97,7 +97,7 @@ func TestPostPerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("POST").Path("/dauth/perms").HandlerFunc(svr.PostPerms)
+	rtr.Methods("POST").Path("/dauth/perms").HandlerFunc(svr.Perms().Post)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -108,7 +108,7 @@ func TestPostPerms(t *testing.T) {
 			w:       httptest.NewRecorder(),
 			r:       fr,
 			expCode: http.StatusOK,
-			expBody: `{"number":1,"message":"Permissions saved","data":[{"id":1,"service":"test","name":"test"}]}` + "\n",
+			expBody: `{"number":1,"message":"Permissions saved","data":[{"index":0,"status":200,"value":{"id":1,"service":"test","name":"test"}}]}` + "\n",
 		},
 	}
 
@@ -126,7 +126,7 @@ func TestPostPerms(t *testing.T) {
 }
 
 func TestPutPermByID(t *testing.T) {
-	jbs := []byte("{\"id\":1}\n")
+	jbs := []byte("{\"id\":1,\"service\":\"test\",\"name\":\"test\"}\n")
 	fr, err := http.NewRequest("PUT", "/dauth/perms/1", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -136,7 +136,7 @@ func TestPutPermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("PUT").Path("/dauth/perms/{id}").HandlerFunc(svr.PutPermByID)
+	rtr.Methods("PUT").Path("/dauth/perms/{id}").HandlerFunc(svr.Perms().PutByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -175,7 +175,7 @@ func TestDeletePerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/perms").HandlerFunc(svr.DeletePerms)
+	rtr.Methods("DELETE").Path("/dauth/perms").HandlerFunc(svr.Perms().Delete)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -213,7 +213,7 @@ func TestDeletePermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/perms/{id}").HandlerFunc(svr.DeletePermByID)
+	rtr.Methods("DELETE").Path("/dauth/perms/{id}").HandlerFunc(svr.Perms().DeleteByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dhaifley/dlib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimit values define a token bucket rate limit of Rate requests per
+// second, with bursts of up to Burst requests. A zero Rate is unlimited.
+type RateLimit struct {
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+}
+
+// normalized returns the limit with a burst of at least one request.
+func (l RateLimit) normalized() RateLimit {
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+
+	return l
+}
+
+// RateLimitError values are returned for requests which exceed a rate limit.
+type RateLimitError struct {
+	Limit      RateLimit
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Error returns the error message.
+func (e *RateLimitError) Error() string {
+	return "rate limit exceeded"
+}
+
+// RateLimiter values limit request rates using token buckets. Default is the
+// limit for routes without their own limit and Login is the limit applied to
+// the failed logins of each user from each client IP address, including
+// requests authenticated with Basic credentials.
+type RateLimiter struct {
+	Default RateLimit
+	Login   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// NewRateLimiter creates and returns a pointer to a RateLimiter value.
+func NewRateLimiter(def, login RateLimit) *RateLimiter {
+	return &RateLimiter{
+		Default: def,
+		Login:   login,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// refill adds the tokens earned since the bucket was last used.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.limit.Burst),
+		b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+}
+
+// bucket returns the refilled bucket for the key. The lock must be held.
+func (rl *RateLimiter) bucket(key string, limit RateLimit, now time.Time) *bucket {
+	rl.takes++
+	if rl.takes%1000 == 0 {
+		rl.sweep(now)
+	}
+
+	b, ok := rl.buckets[key]
+	if !ok || b.limit != limit {
+		b = &bucket{tokens: float64(limit.Burst), last: now, limit: limit}
+		rl.buckets[key] = b
+	}
+
+	b.refill(now)
+	return b
+}
+
+// exceeded returns the error for a request made when the bucket is empty.
+func (b *bucket) exceeded() *RateLimitError {
+	return &RateLimitError{
+		Limit:      b.limit,
+		Reset:      b.reset(),
+		RetryAfter: time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second)),
+	}
+}
+
+// Take removes a token from the bucket for the key. It returns the number of
+// tokens remaining and the time until the bucket is full again. If no token
+// was available a RateLimitError is returned.
+func (rl *RateLimiter) Take(key string, limit RateLimit) (int, time.Duration, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	b := rl.bucket(key, limit, time.Now())
+	if b.tokens < 1 {
+		return 0, b.reset(), b.exceeded()
+	}
+
+	b.tokens--
+	return int(b.tokens), b.reset(), nil
+}
+
+// Check returns a RateLimitError if the bucket for the key has no tokens,
+// without removing one.
+func (rl *RateLimiter) Check(key string, limit RateLimit) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if b := rl.bucket(key, limit, time.Now()); b.tokens < 1 {
+		return b.exceeded()
+	}
+
+	return nil
+}
+
+// reset returns the time until the bucket is full.
+func (b *bucket) reset() time.Duration {
+	return time.Duration((float64(b.limit.Burst) - b.tokens) /
+		b.limit.Rate * float64(time.Second))
+}
+
+// sweep removes buckets which have refilled, since they are equivalent to
+// new buckets. The lock must be held.
+func (rl *RateLimiter) sweep(now time.Time) {
+	for k, b := range rl.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+// seconds returns a duration in whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// setRateLimitHeaders sets the RateLimit headers on a response.
+func setRateLimitHeaders(w http.ResponseWriter, limit RateLimit, remaining int, reset time.Duration) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("RateLimit-Reset", seconds(reset))
+}
+
+// rateLimitKey returns the key identifying the client of a request. Requests
+// are identified by their user once they have been authenticated, and
+// otherwise by their client IP address, so that unchecked credentials never
+// select a bucket.
+func rateLimitKey(r *http.Request) string {
+	if ri := GetRequestInfo(r.Context()); ri != nil && ri.User != "" {
+		return "user:" + ri.User
+	}
+
+	return "ip:" + clientIP(r.RemoteAddr)
+}
+
+// RateLimit wraps a handler function with rate limiting. The route limit is
+// used if the route has one, with a bucket per client for the route.
+// Otherwise the default limit is used, with a bucket per client shared by all
+// routes without their own limit. Routes requiring authorization are wrapped
+// with their rate limit inside the authentication handler.
+func (s *Server) RateLimit(handler http.Handler, route Route) http.Handler {
+	if s.Limiter == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, scope := s.Limiter.Default, "default"
+		if route.RateLimit != nil {
+			limit, scope = *route.RateLimit, route.Service+"."+route.Name
+		}
+
+		if limit.Rate <= 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		limit = limit.normalized()
+		remaining, reset, err := s.Limiter.Take(scope+"|"+rateLimitKey(r), limit)
+		if err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		setRateLimitHeaders(w, limit, remaining, reset)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// loginKey returns the key of the bucket counting the failed logins of a user
+// from the client IP address of a request.
+func loginKey(r *http.Request, user string) string {
+	return "login|" + user + "|" + clientIP(r.RemoteAddr)
+}
+
+// authFailure checks whether an error rejects the credentials of a request.
+func authFailure(err error) bool {
+	if e, ok := err.(*dlib.Error); ok {
+		return e.Code == http.StatusUnauthorized || e.Code == http.StatusForbidden
+	}
+
+	switch status.Code(err) {
+	case codes.Unauthenticated, codes.PermissionDenied,
+		codes.NotFound, codes.InvalidArgument:
+		return true
+	}
+
+	return false
+}
+
+// LoginLimit checks whether a user has used up its failed logins from the
+// client of a request. Logins are refused without contacting the dauth
+// service until its bucket refills.
+func (s *Server) LoginLimit(r *http.Request, user string) error {
+	if s.Limiter == nil || s.Limiter.Login.Rate <= 0 {
+		return nil
+	}
+
+	return s.Limiter.Check(loginKey(r, user), s.Limiter.Login.normalized())
+}
+
+// loginFailed counts a login by a user against the login rate limit when the
+// error rejects its credentials.
+func (s *Server) loginFailed(r *http.Request, user string, err error) {
+	if s.Limiter == nil || s.Limiter.Login.Rate <= 0 || !authFailure(err) {
+		return
+	}
+
+	s.Limiter.Take(loginKey(r, user), s.Limiter.Login.normalized())
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerRateLimit(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, Limiter: NewRateLimiter(RateLimit{Rate: 1, Burst: 2}, RateLimit{})}
+	fh := FakeHandler{false}
+	cases := []struct {
+		route        Route
+		user         string
+		token        string
+		remote       string
+		expCode      int
+		expRemaining string
+	}{
+		{
+			route:        Route{Service: "dauth", Name: "GetUsers"},
+			user:         "a",
+			expCode:      http.StatusOK,
+			expRemaining: "1",
+		},
+		{
+			route:        Route{Service: "dauth", Name: "GetPerms"},
+			user:         "a",
+			expCode:      http.StatusOK,
+			expRemaining: "0",
+		},
+		{
+			route:        Route{Service: "dauth", Name: "GetUsers"},
+			user:         "a",
+			expCode:      http.StatusTooManyRequests,
+			expRemaining: "0",
+		},
+		{
+			route:        Route{Service: "dauth", Name: "GetUsers"},
+			user:         "b",
+			expCode:      http.StatusOK,
+			expRemaining: "1",
+		},
+		{
+			route: Route{Service: "dauth", Name: "GetTokens",
+				RateLimit: &RateLimit{Rate: 1, Burst: 5}},
+			user:         "a",
+			expCode:      http.StatusOK,
+			expRemaining: "4",
+		},
+		{
+			route:        Route{Service: "dapi", Name: "GetIndex"},
+			token:        "x",
+			remote:       "10.0.0.1:1000",
+			expCode:      http.StatusOK,
+			expRemaining: "1",
+		},
+		{
+			route:        Route{Service: "dapi", Name: "GetIndex"},
+			token:        "y",
+			remote:       "10.0.0.1:1001",
+			expCode:      http.StatusOK,
+			expRemaining: "0",
+		},
+		{
+			route:        Route{Service: "dapi", Name: "GetIndex"},
+			token:        "z",
+			remote:       "10.0.0.1:1002",
+			expCode:      http.StatusTooManyRequests,
+			expRemaining: "0",
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		if c.user != "" {
+			fr = fr.WithContext(WithRequestInfo(fr.Context(), &RequestInfo{User: c.user}))
+		}
+
+		if c.token != "" {
+			fr.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		fr.RemoteAddr = c.remote
+		w := httptest.NewRecorder()
+		svr.RateLimit(fh, c.route).ServeHTTP(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if got := w.Header().Get("RateLimit-Remaining"); got != c.expRemaining {
+			t.Errorf("RateLimit-Remaining expected: %v, got: %v", c.expRemaining, got)
+		}
+
+		if c.expCode == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Error("Retry-After expected")
+		}
+	}
+}
+
+// LoginAuthClient values accept only the test password and token, and count
+// the requests made to them.
+type LoginAuthClient struct {
+	FakeAuthClient
+	calls int
+}
+
+func (lc *LoginAuthClient) Login(ctx context.Context, in *ptypes.UserRequest, opts ...grpc.CallOption) (*ptypes.TokenResponse, error) {
+	lc.calls++
+	if in.Pass != "testpass" {
+		return nil, status.Error(codes.Unauthenticated, "invalid password")
+	}
+
+	return lc.FakeAuthClient.Login(ctx, in, opts...)
+}
+
+func (lc *LoginAuthClient) Auth(ctx context.Context, in *ptypes.AuthRequest, opts ...grpc.CallOption) (*ptypes.AuthResponse, error) {
+	lc.calls++
+	return &ptypes.AuthResponse{Ok: in.Token.Token == "test"}, nil
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	lc := LoginAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &lc, Log: lm,
+		Limiter: NewRateLimiter(RateLimit{}, RateLimit{Rate: 0.01, Burst: 1})}
+	cases := []struct {
+		user     string
+		pass     string
+		remote   string
+		expCode  int
+		expCalls int
+	}{
+		{pass: "testpass", remote: "10.0.0.1:1000", expCode: http.StatusOK, expCalls: 1},
+		{pass: "testpass", remote: "10.0.0.1:1000", expCode: http.StatusOK, expCalls: 1},
+		{pass: "wrong", remote: "10.0.0.1:1000", expCode: http.StatusUnauthorized, expCalls: 1},
+		{pass: "testpass", remote: "10.0.0.1:1000", expCode: http.StatusTooManyRequests},
+		{pass: "testpass", remote: "10.0.0.2:1000", expCode: http.StatusOK, expCalls: 1},
+		{user: "other", pass: "testpass", remote: "10.0.0.1:1000",
+			expCode: http.StatusOK, expCalls: 1},
+	}
+
+	for _, c := range cases {
+		lc.calls = 0
+		if c.user == "" {
+			c.user = "testuser"
+		}
+
+		jbs := []byte(`{"user":"` + c.user + `","pass":"` + c.pass + `"}`)
+		fr, err := http.NewRequest("POST", "/dauth/login", bytes.NewBuffer(jbs))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.RemoteAddr = c.remote
+		w := httptest.NewRecorder()
+		svr.Login(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if lc.calls != c.expCalls {
+			t.Errorf("Calls expected: %v, got: %v", c.expCalls, lc.calls)
+		}
+	}
+}
+
+func TestServerAuthHandlerLoginLimit(t *testing.T) {
+	lc := LoginAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &lc, Log: lm,
+		Limiter: NewRateLimiter(RateLimit{}, RateLimit{Rate: 0.01, Burst: 2})}
+	h := svr.AuthHandler(FakeHandler{}, &dauth.Perm{Service: "dauth", Name: "GetUsers"})
+	cases := []struct {
+		header   string
+		value    string
+		expCode  int
+		expCalls int
+	}{
+		{header: "Token", value: "test", expCode: http.StatusOK, expCalls: 1},
+		{header: "Token", value: "random1", expCode: http.StatusUnauthorized, expCalls: 1},
+		{header: "Token", value: "random2", expCode: http.StatusUnauthorized, expCalls: 1},
+		{header: "Token", value: "random3", expCode: http.StatusUnauthorized, expCalls: 1},
+		{header: "Authorization", value: "Basic dGVzdHVzZXI6d3Jvbmc=",
+			expCode: http.StatusUnauthorized, expCalls: 1},
+		{header: "Authorization", value: "Basic dGVzdHVzZXI6d3Jvbmc=",
+			expCode: http.StatusUnauthorized, expCalls: 1},
+		{header: "Authorization", value: "Basic dGVzdHVzZXI6dGVzdHBhc3M=",
+			expCode: http.StatusTooManyRequests},
+		{header: "Authorization", value: "Basic b3RoZXI6dGVzdHBhc3M=",
+			expCode: http.StatusOK, expCalls: 2},
+		{header: "Token", value: "test", expCode: http.StatusOK, expCalls: 1},
+	}
+	for _, c := range cases {
+		lc.calls = 0
+		fr, err := http.NewRequest("GET", "/dauth/users", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.RemoteAddr = "10.0.0.1:1000"
+		fr.Header.Set(c.header, c.value)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if lc.calls != c.expCalls {
+			t.Errorf("Calls expected: %v, got: %v", c.expCalls, lc.calls)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// reflectTimeout is the time allowed to read the descriptors of a backend
+// using reflection.
+var reflectTimeout = 10 * time.Second
+
+// reflectInterval is the shortest time between reads of the descriptors of a
+// backend made on demand.
+var reflectInterval = time.Minute
+
+// reflectRequest sends a request to the reflection service and returns its
+// response.
+func reflectRequest(stream rpb.ServerReflection_ServerReflectionInfoClient,
+	req *rpb.ServerReflectionRequest) (*rpb.ServerReflectionResponse, error) {
+	if err := stream.Send(req); err != nil {
+		return nil, err
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	if e := res.GetErrorResponse(); e != nil {
+		return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+	}
+
+	return res, nil
+}
+
+// ReflectDescriptors reads the file descriptors of the services of a backend,
+// and the files they import, using the gRPC server reflection service.
+func ReflectDescriptors(ctx context.Context, conn grpc.ClientConnInterface) (*protoregistry.Files, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := reflectRequest(stream, &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reqs := []*rpb.ServerReflectionRequest{}
+	for _, svc := range res.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(svc.GetName(), "grpc.reflection.") {
+			continue
+		}
+
+		reqs = append(reqs, &rpb.ServerReflectionRequest{
+			MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{
+				FileContainingSymbol: svc.GetName(),
+			},
+		})
+	}
+
+	fdps := map[string]*descriptorpb.FileDescriptorProto{}
+	requested := map[string]bool{}
+	for len(reqs) > 0 {
+		res, err := reflectRequest(stream, reqs[0])
+		if err != nil {
+			return nil, err
+		}
+
+		reqs = reqs[1:]
+		for _, data := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fdp := descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(data, &fdp); err != nil {
+				return nil, fmt.Errorf("unable to parse descriptor: %v", err)
+			}
+
+			fdps[fdp.GetName()] = &fdp
+		}
+
+		for _, fdp := range fdps {
+			for _, dep := range fdp.GetDependency() {
+				if _, ok := fdps[dep]; ok || requested[dep] {
+					continue
+				}
+
+				requested[dep] = true
+				reqs = append(reqs, &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{
+						FileByFilename: dep,
+					},
+				})
+			}
+		}
+	}
+
+	set := descriptorpb.FileDescriptorSet{}
+	for _, fdp := range fdps {
+		set.File = append(set.File, fdp)
+	}
+
+	sort.Slice(set.File, func(i, j int) bool {
+		return set.File[i].GetName() < set.File[j].GetName()
+	})
+
+	return protodesc.NewFiles(&set)
+}
+
+// Reflect reads the descriptors of a backend using reflection.
+func (b *Backend) Reflect(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, reflectTimeout)
+	defer cancel()
+	files, err := ReflectDescriptors(ctx, b.Conn)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.Files = files
+	b.mu.Unlock()
+	return nil
+}
+
+// FindMethod returns the descriptor of a method served by a backend, named by
+// its full method name. When a backend using reflection does not serve the
+// method its descriptors are read again, at most once each reflectInterval.
+func (b *Backend) FindMethod(ctx context.Context, name string) (protoreflect.MethodDescriptor, error) {
+	b.mu.RLock()
+	files := b.Files
+	b.mu.RUnlock()
+	md, err := findMethod(files, name)
+	if p, ok := err.(*Problem); !ok || p.Code != ErrNotFound || !b.Config.Reflection {
+		return md, err
+	}
+
+	b.mu.Lock()
+	if time.Since(b.reflected) < reflectInterval {
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	b.reflected = time.Now()
+	b.mu.Unlock()
+	if err := b.Reflect(ctx); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	files = b.Files
+	b.mu.RUnlock()
+	return findMethod(files, name)
+}
+
+// findRPC returns the backend using reflection which serves a method, and
+// the descriptor of the method.
+func (s *Server) findRPC(ctx context.Context, name string) (*Backend, protoreflect.MethodDescriptor, error) {
+	var err error = NewProblem(ErrNotFound, fmt.Sprintf("unknown method %q", name))
+	for _, b := range s.Backends {
+		if !b.Config.Reflection {
+			continue
+		}
+
+		md, ferr := b.FindMethod(ctx, name)
+		if ferr == nil {
+			return b, md, nil
+		}
+
+		if p, ok := ferr.(*Problem); !ok || p.Code != ErrNotFound {
+			err = ferr
+		}
+	}
+
+	return nil, nil, err
+}
+
+// CallRPC is the handler function for requests calling the methods of
+// backends using reflection. Requests are authorized using the service and
+// method names as the permission, and the request body is the JSON request
+// message.
+func (s *Server) CallRPC(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	s.AuthHandler(http.HandlerFunc(s.callRPC), &dauth.Perm{
+		Service: vars["service"],
+		Name:    vars["method"],
+	}).ServeHTTP(w, r)
+}
+
+// callRPC calls a backend method found using reflection.
+func (s *Server) callRPC(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	b, md, err := s.findRPC(r.Context(), vars["service"]+"/"+vars["method"])
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if md.IsStreamingClient() {
+		s.RespondWithError(NewProblem(ErrNotImplemented,
+			"client streaming methods are not supported"), w, r)
+		return
+	}
+
+	in := dynamicpb.NewMessage(md.Input())
+	if err := s.decodeMessageBody(w, r, in); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	s.invoke(w, r, b, md, in)
+}
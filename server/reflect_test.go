@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhaifley/dlib/ptypes"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+)
+
+// PermAuthClient values allow requests for the permissions of one service,
+// and record the permissions requested.
+type PermAuthClient struct {
+	FakeAuthClient
+	Service string
+	Perms   []string
+}
+
+func (pc *PermAuthClient) Auth(ctx context.Context, in *ptypes.AuthRequest, opts ...grpc.CallOption) (*ptypes.AuthResponse, error) {
+	pc.Perms = append(pc.Perms, in.Perm.Service+"/"+in.Perm.Name)
+	return &ptypes.AuthResponse{Ok: in.Perm.Service == pc.Service}, nil
+}
+
+func TestReflectDescriptors(t *testing.T) {
+	conn, _, stop := NewTestBackendServer(t)
+	defer stop()
+	files, err := ReflectDescriptors(context.Background(), conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		expErr string
+	}{
+		{name: "test.Widgets/GetWidget"},
+		{name: "test.Widgets/ListWidgets"},
+		{name: "test.Widgets/GetGadget", expErr: `unknown method "test.Widgets/GetGadget"`},
+		{
+			name:   "grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+			expErr: `unknown service "grpc.reflection.v1alpha.ServerReflection"`,
+		},
+	}
+
+	for _, c := range cases {
+		md, err := findMethod(files, c.name)
+		if c.expErr == "" {
+			if err != nil || fullMethod(md) != "/"+c.name {
+				t.Errorf("Method expected: %v, got: %v %v", c.name, md, err)
+			}
+
+			continue
+		}
+
+		if err == nil || err.Error() != c.expErr {
+			t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+		}
+	}
+}
+
+func TestServerCallRPC(t *testing.T) {
+	conn, _, stop := NewTestBackendServer(t)
+	defer stop()
+	b, err := NewBackend(BackendConfig{Name: "widgets", Reflection: true}, conn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc := PermAuthClient{Service: "test.Widgets"}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &pc, Log: lm, Backends: []*Backend{b}}
+	if err := svr.InitRouter(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path    string
+		body    string
+		token   string
+		accept  string
+		expCode int
+		expBody string
+		expPerm string
+	}{
+		{
+			path:    "/test.Widgets/rpc/GetWidget",
+			body:    `{"id":2}`,
+			token:   "test",
+			expCode: http.StatusOK,
+			expBody: `{"id":2,"name":"b"}` + "\n",
+			expPerm: "test.Widgets/GetWidget",
+		},
+		{
+			path:    "/test.Widgets/rpc/GetWidget",
+			body:    `{"id":4}`,
+			token:   "test",
+			expCode: http.StatusNotFound,
+			expBody: `{"code":404,"message":"widget not found"}` + "\n",
+			expPerm: "test.Widgets/GetWidget",
+		},
+		{
+			path:    "/test.Widgets/rpc/ListWidgets",
+			body:    `{"tags":["x"]}`,
+			token:   "test",
+			expCode: http.StatusOK,
+			expBody: `[{"id":1,"name":"a","tags":["x"]},{"id":2,"name":"b","tags":["x"]},` +
+				`{"id":3,"name":"c","tags":["x"]}]` + "\n",
+			expPerm: "test.Widgets/ListWidgets",
+		},
+		{
+			path:    "/test.Widgets/rpc/ListWidgets",
+			token:   "test",
+			accept:  "application/x-ndjson",
+			expCode: http.StatusOK,
+			expBody: `{"id":1,"name":"a"}` + "\n" + `{"id":2,"name":"b"}` + "\n" +
+				`{"id":3,"name":"c"}` + "\n",
+			expPerm: "test.Widgets/ListWidgets",
+		},
+		{
+			path:    "/test.Widgets/rpc/GetWidget",
+			body:    `{"color":"red"}`,
+			token:   "test",
+			expCode: http.StatusBadRequest,
+			expPerm: "test.Widgets/GetWidget",
+		},
+		{
+			path:    "/test.Widgets/rpc/GetGadget",
+			token:   "test",
+			expCode: http.StatusNotFound,
+			expBody: `{"code":404,"message":"unknown method \"test.Widgets/GetGadget\""}` + "\n",
+			expPerm: "test.Widgets/GetGadget",
+		},
+		{
+			path:    "/test.Widgets/rpc/SaveWidgets",
+			token:   "test",
+			expCode: http.StatusNotImplemented,
+			expPerm: "test.Widgets/SaveWidgets",
+		},
+		{
+			path:    "/test.Gadgets/rpc/GetGadget",
+			token:   "test",
+			expCode: http.StatusUnauthorized,
+			expPerm: "test.Gadgets/GetGadget",
+		},
+		{
+			path:    "/test.Widgets/rpc/GetWidget",
+			body:    `{"id":2}`,
+			expCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		pc.Perms = nil
+		r, err := http.NewRequest("POST", c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		if c.token != "" {
+			r.Header.Set("Token", c.token)
+		}
+
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+
+		w := httptest.NewRecorder()
+		svr.ServeHTTP(w, r)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expBody != "" && w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+
+		perm := strings.Join(pc.Perms, ",")
+		if perm != c.expPerm {
+			t.Errorf("Perm expected: %v, got: %v", c.expPerm, perm)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RequestIDHeader is the header used to receive and return request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestInfoKey contextKey = iota
+
+// RequestInfo values contain information about a request which is collected
+// as it passes through the middleware chain.
+type RequestInfo struct {
+	ID      string
+	Name    string
+	Service string
+	User    string
+	Remote  string
+}
+
+// GetRequestInfo returns the request information stored in a context, or nil
+// if the context does not contain any.
+func GetRequestInfo(ctx context.Context) *RequestInfo {
+	ri, _ := ctx.Value(requestInfoKey).(*RequestInfo)
+	return ri
+}
+
+// WithRequestInfo returns a copy of the context containing the request
+// information.
+func WithRequestInfo(ctx context.Context, ri *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey, ri)
+}
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the inbound request ID of a request if it is valid, or a
+// new request ID if it is not.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		return NewRequestID()
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return NewRequestID()
+		}
+	}
+
+	return id
+}
+
+// responseWriter values wrap an http.ResponseWriter to record the status code
+// and size of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader records the status code and writes the response header.
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the size of the data and writes it to the response.
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += n
+	return n, err
+}
+
+// Flush sends any buffered data to the client.
+func (rw *responseWriter) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		if rw.status == 0 {
+			rw.status = http.StatusOK
+		}
+
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, errors.New("response writer does not support hijacking")
+}
+
+// Status returns the status code of the response.
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+
+	return rw.status
+}
+
+// accepts checks whether the Accept header of a request lists a media type.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(v, ";", 2)[0]) == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
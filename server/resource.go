@@ -0,0 +1,514 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/dhaifley/dlib"
+	"github.com/gorilla/mux"
+)
+
+// RecvStream is the interface implemented by the client streams returned
+// when getting backend records.
+type RecvStream[Res any] interface {
+	Recv() (*Res, error)
+}
+
+// SaveStream is the interface implemented by the client streams used to save
+// backend records.
+type SaveStream[Req, Res any] interface {
+	Send(*Req) error
+	Recv() (*Res, error)
+	CloseSend() error
+}
+
+// Resource values describe a backend resource of type T, which is requested
+// using Req values and returned in Res values, and provide the handlers and
+// routes used to list, get, save and delete it.
+//
+// Name is the plural name used in route names, such as "Users", which gives
+// routes named GetUsers, SaveUsers and DeleteUsers. Noun and Nouns are used
+// in response messages. Records are read from Fetch streams, written to Save
+// streams and deleted by Remove, which returns the number deleted.
+//
+// Clean, when set, removes values which must not be returned to clients, and
+// which are not saved again when a patch does not set them.
+// Modified returns the time a record was last modified, if it is known.
+// Invalidate removes the authorization decisions affected by saving or
+// deleting records. When it is not set the authorization cache is purged.
+type Resource[T, Req, Res any] struct {
+	Server       *Server
+	Service      string
+	Name         string
+	Path         string
+	Noun         string
+	Nouns        string
+	Schema       Schema
+	Fetch        func(ctx context.Context, req *Req) (RecvStream[Res], error)
+	Save         func(ctx context.Context) (SaveStream[Req, Res], error)
+	Remove       func(ctx context.Context, req *Req) (int64, error)
+	ToRequest    func(v *T) Req
+	FromResponse func(v *T, res *Res) error
+	FromQuery    func(v *T, vals url.Values) error
+	SetID        func(v *T, id int64)
+	Clean        func(v *T)
+	Modified     func(v *T) time.Time
+	Invalidate   func(vals ...T)
+}
+
+// Routes returns the routes for the resource. Their targets are named for
+// the resource and handler, such as "dauth.Users.GetByID".
+func (rs *Resource[T, Req, Res]) Routes() []Route {
+	id := rs.Path + "/{id}"
+	routes := []Route{}
+	for _, rt := range []struct {
+		name, path, method, op string
+		handler                http.HandlerFunc
+	}{
+		{"Get", rs.Path, "GET", "Get", rs.Get},
+		{"Get", id, "GET", "GetByID", rs.GetByID},
+		{"Save", rs.Path, "POST", "Post", rs.Post},
+		{"Save", id, "PUT", "PutByID", rs.PutByID},
+		{"Save", id, "PATCH", "PatchByID", rs.PatchByID},
+		{"Delete", id, "DELETE", "DeleteByID", rs.DeleteByID},
+		{"Delete", rs.Path, "DELETE", "Delete", rs.Delete},
+	} {
+		routes = append(routes, Route{
+			Service:     rs.Service,
+			Name:        rt.name + rs.Name,
+			Path:        rt.path,
+			Method:      rt.method,
+			Auth:        true,
+			Target:      rs.Service + "." + rs.Name + "." + rt.op,
+			HandlerFunc: rt.handler,
+		})
+	}
+
+	return routes
+}
+
+// clean removes the values which must not be returned to clients.
+func (rs *Resource[T, Req, Res]) clean(v *T) {
+	if rs.Clean != nil {
+		rs.Clean(v)
+	}
+}
+
+// invalidate removes the authorization decisions affected by a change to
+// records.
+func (rs *Resource[T, Req, Res]) invalidate(vals ...T) {
+	if rs.Invalidate == nil {
+		rs.Server.AuthCache.Purge()
+		return
+	}
+
+	rs.Invalidate(vals...)
+}
+
+// id returns the id value from the request path.
+func (rs *Resource[T, Req, Res]) id(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, dlib.NewError(http.StatusBadRequest, "invalid id value")
+	}
+
+	return id, nil
+}
+
+// idRequest returns the backend request for the record with an id.
+func (rs *Resource[T, Req, Res]) idRequest(id int64) Req {
+	var v T
+	rs.SetID(&v, id)
+	return rs.ToRequest(&v)
+}
+
+// fetchByID returns the record with an id, or nil if it does not exist.
+func (rs *Resource[T, Req, Res]) fetchByID(ctx context.Context, id int64) (*T, error) {
+	req := rs.idRequest(id)
+	var stream RecvStream[Res]
+	if err := rs.Server.Call(ctx, func(ctx context.Context) error {
+		var err error
+		stream, err = rs.Fetch(ctx, &req)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	var v *T
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return v, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		v = new(T)
+		if err := rs.FromResponse(v, res); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// saveOne saves a single record and returns the saved value.
+func (rs *Resource[T, Req, Res]) saveOne(ctx context.Context, v *T) (T, error) {
+	var val T
+	var stream SaveStream[Req, Res]
+	if err := rs.Server.Call(ctx, func(ctx context.Context) error {
+		var err error
+		stream, err = rs.Save(ctx)
+		return err
+	}); err != nil {
+		return val, err
+	}
+
+	req := rs.ToRequest(v)
+	if err := stream.Send(&req); err != nil {
+		return val, err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return val, err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return val, err
+		}
+
+		if err := rs.FromResponse(&val, res); err != nil {
+			return val, err
+		}
+	}
+
+	rs.clean(&val)
+	return val, nil
+}
+
+// respond responds with a result.
+func (rs *Resource[T, Req, Res]) respond(w http.ResponseWriter, res dlib.Result) {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		rs.Server.Log.Error(err)
+	}
+}
+
+// Get is the get handler function for the resource.
+func (rs *Resource[T, Req, Res]) Get(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	var q T
+	opts, vals, err := s.ListQuery(r, q)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if len(vals) != 0 {
+		if err := rs.FromQuery(&q, vals); err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	req := rs.ToRequest(&q)
+	var stream RecvStream[Res]
+	if err := s.Call(ctx, func(ctx context.Context) error {
+		var err error
+		stream, err = rs.Fetch(ctx, &req)
+		return err
+	}); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	s.RespondWithList(w, r, opts, func() (interface{}, error) {
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		var v T
+		if err := rs.FromResponse(&v, res); err != nil {
+			return nil, err
+		}
+
+		rs.clean(&v)
+		return v, nil
+	})
+}
+
+// GetByID is the get by id handler function for the resource.
+func (rs *Resource[T, Req, Res]) GetByID(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	id, err := rs.id(r)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	v, err := rs.fetchByID(r.Context(), id)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if v == nil {
+		s.RespondNotFound(w, r)
+		return
+	}
+
+	rs.clean(v)
+	modified := time.Time{}
+	if rs.Modified != nil {
+		modified = rs.Modified(v)
+	}
+
+	s.RespondWithResource(w, r, v, modified)
+}
+
+// Post is the post handler function for the resource. Each value is reported
+// with its own result, so that one failure does not prevent the other values
+// being saved.
+func (rs *Resource[T, Req, Res]) Post(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	vals := []T{}
+	err := s.DecodeBody(w, r, &vals, rs.Schema)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	defer r.Body.Close()
+	results := make([]BulkResult, len(vals))
+	for i := 0; i < len(vals); {
+		i = rs.saveFrom(w, r, vals, i, results)
+	}
+
+	rs.invalidate(vals...)
+	s.RespondWithBulk(w, r, rs.Nouns, results)
+}
+
+// saveFrom saves the values from index i on a new stream and records their
+// results. Replies are collected while the values are sent, since the backend
+// may stop reading until its replies are read. Values which were sent are
+// never sent again, since they may have been saved, so those without a reply
+// fail with the error which ended the stream. When a value could not be sent
+// it returns the index of the first value which still needs to be saved.
+func (rs *Resource[T, Req, Res]) saveFrom(w http.ResponseWriter, r *http.Request, vals []T,
+	i int, results []BulkResult) int {
+	s := rs.Server
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var stream SaveStream[Req, Res]
+	if err := s.Call(ctx, func(ctx context.Context) error {
+		var err error
+		stream, err = rs.Save(ctx)
+		return err
+	}); err != nil {
+		results[i] = s.bulkFailed(w, r, i, err)
+		return i + 1
+	}
+
+	replies := []*Res{}
+	var rerr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			res, err := stream.Recv()
+			if err != nil {
+				rerr = err
+				return
+			}
+
+			replies = append(replies, res)
+		}
+	}()
+
+	sent := i
+	var serr error
+	for ; sent < len(vals); sent++ {
+		req := rs.ToRequest(&vals[sent])
+		if serr = stream.Send(&req); serr != nil {
+			break
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		s.Log.Error(err)
+	}
+
+	<-done
+	for j := i; j < sent; j++ {
+		if j-i >= len(replies) {
+			results[j] = s.bulkFailed(w, r, j, rerr)
+			continue
+		}
+
+		var val T
+		if err := rs.FromResponse(&val, replies[j-i]); err != nil {
+			results[j] = s.bulkFailed(w, r, j, err)
+			continue
+		}
+
+		rs.clean(&val)
+		results[j] = bulkSaved(j, val)
+	}
+
+	if sent == len(vals) {
+		return sent
+	}
+
+	if serr == io.EOF && rerr != io.EOF {
+		serr = rerr
+	}
+
+	results[sent] = s.bulkFailed(w, r, sent, serr)
+	return sent + 1
+}
+
+// PutByID is the put handler function for the resource.
+func (rs *Resource[T, Req, Res]) PutByID(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	id, err := rs.id(r)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	var v T
+	err = s.DecodeBody(w, r, &v, rs.Schema)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	defer r.Body.Close()
+	rs.SetID(&v, id)
+	val, err := rs.saveOne(r.Context(), &v)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	rs.invalidate(v)
+	rs.respond(w, dlib.Result{
+		Msg: rs.Noun + " saved",
+		Num: 1,
+		Val: &val,
+	})
+}
+
+// PatchByID is the patch handler function for the resource. It applies a
+// JSON Merge Patch or JSON Patch document to the current record.
+func (rs *Resource[T, Req, Res]) PatchByID(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	id, err := rs.id(r)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	cur, err := rs.fetchByID(r.Context(), id)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if cur == nil {
+		s.RespondNotFound(w, r)
+		return
+	}
+
+	orig := *cur
+	rs.clean(cur)
+	var v T
+	if err := s.ApplyPatch(w, r, cur, &v, rs.Schema); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	rs.SetID(&v, id)
+	val, err := rs.saveOne(r.Context(), &v)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	rs.invalidate(orig, val)
+	rs.respond(w, dlib.Result{
+		Msg: rs.Noun + " saved",
+		Num: 1,
+		Val: &val,
+	})
+}
+
+// Delete is the delete handler function for the resource.
+func (rs *Resource[T, Req, Res]) Delete(w http.ResponseWriter, r *http.Request) {
+	s := rs.Server
+	var q T
+	err := s.DecodeBody(w, r, &q, nil)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	defer r.Body.Close()
+	req := rs.ToRequest(&q)
+	rs.delete(w, r, &req, rs.Nouns+" deleted", q)
+}
+
+// DeleteByID is the delete by id handler function for the resource.
+func (rs *Resource[T, Req, Res]) DeleteByID(w http.ResponseWriter, r *http.Request) {
+	id, err := rs.id(r)
+	if err != nil {
+		rs.Server.RespondWithError(err, w, r)
+		return
+	}
+
+	var q T
+	rs.SetID(&q, id)
+	req := rs.ToRequest(&q)
+	rs.delete(w, r, &req, rs.Noun+" deleted", q)
+}
+
+// delete deletes the records matching a request and responds with the
+// number deleted.
+func (rs *Resource[T, Req, Res]) delete(w http.ResponseWriter, r *http.Request, req *Req,
+	msg string, q T) {
+	s := rs.Server
+	var num int64
+	if err := s.Call(r.Context(), func(ctx context.Context) error {
+		var err error
+		num, err = rs.Remove(ctx, req)
+		return err
+	}); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	rs.invalidate(q)
+	if num == 0 {
+		s.RespondNotFound(w, r)
+		return
+	}
+
+	rs.respond(w, dlib.Result{
+		Msg: msg,
+		Num: int(num),
+	})
+}
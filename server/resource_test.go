@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type Widget struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// WidgetStream values reply to the widgets sent to them only once the
+// stream is closed.
+type WidgetStream struct {
+	vals   []Widget
+	closed bool
+}
+
+func (ws *WidgetStream) Send(m *Widget) error {
+	ws.vals = append(ws.vals, *m)
+	return nil
+}
+
+func (ws *WidgetStream) Recv() (*Widget, error) {
+	if !ws.closed {
+		return nil, errors.New("no reply before close")
+	}
+
+	if len(ws.vals) == 0 {
+		return nil, io.EOF
+	}
+
+	v := ws.vals[0]
+	ws.vals = ws.vals[1:]
+	return &v, nil
+}
+
+func (ws *WidgetStream) CloseSend() error {
+	ws.closed = true
+	return nil
+}
+
+type WidgetStore map[int64]Widget
+
+func (st WidgetStore) find(req *Widget) []Widget {
+	vals := []Widget{}
+	for _, v := range st {
+		if (req.ID == 0 || v.ID == req.ID) && (req.Name == "" || v.Name == req.Name) {
+			vals = append(vals, v)
+		}
+	}
+
+	sort.Slice(vals, func(i, j int) bool {
+		return vals[i].ID < vals[j].ID
+	})
+
+	return vals
+}
+
+func NewWidgets(s *Server, st WidgetStore) *Resource[Widget, Widget, Widget] {
+	return &Resource[Widget, Widget, Widget]{
+		Server:  s,
+		Service: "widgets",
+		Name:    "Widgets",
+		Path:    "/widgets",
+		Noun:    "Widget",
+		Nouns:   "Widgets",
+		Schema:  Schema{"name": {Required: true}},
+		Fetch: func(ctx context.Context, req *Widget) (RecvStream[Widget], error) {
+			return &WidgetStream{vals: st.find(req), closed: true}, nil
+		},
+		Save: func(ctx context.Context) (SaveStream[Widget, Widget], error) {
+			return &WidgetStream{}, nil
+		},
+		Remove: func(ctx context.Context, req *Widget) (int64, error) {
+			vals := st.find(req)
+			for _, v := range vals {
+				delete(st, v.ID)
+			}
+
+			return int64(len(vals)), nil
+		},
+		ToRequest: func(v *Widget) Widget {
+			return *v
+		},
+		FromResponse: func(v *Widget, res *Widget) error {
+			*v = *res
+			return nil
+		},
+		FromQuery: func(v *Widget, vals url.Values) error {
+			v.Name = vals.Get("name")
+			return nil
+		},
+		SetID: func(v *Widget, id int64) {
+			v.ID = id
+		},
+		Clean: func(v *Widget) {
+			v.Secret = ""
+		},
+		Invalidate: func(vals ...Widget) {},
+	}
+}
+
+func TestResourceRoutes(t *testing.T) {
+	rs := NewWidgets(&Server{}, WidgetStore{})
+	cases := []struct {
+		method string
+		path   string
+		name   string
+	}{
+		{"GET", "/widgets", "GetWidgets"},
+		{"GET", "/widgets/{id}", "GetWidgets"},
+		{"POST", "/widgets", "SaveWidgets"},
+		{"PUT", "/widgets/{id}", "SaveWidgets"},
+		{"PATCH", "/widgets/{id}", "SaveWidgets"},
+		{"DELETE", "/widgets/{id}", "DeleteWidgets"},
+		{"DELETE", "/widgets", "DeleteWidgets"},
+	}
+
+	routes := rs.Routes()
+	if len(routes) != len(cases) {
+		t.Fatalf("Routes expected: %v, got: %v", len(cases), len(routes))
+	}
+
+	for i, c := range cases {
+		rt := routes[i]
+		if rt.Method != c.method || rt.Path != c.path || rt.Name != c.name ||
+			rt.Service != "widgets" || !rt.Auth {
+			t.Errorf("Route expected: %v %v %v, got: %v %v %v", c.method, c.path,
+				c.name, rt.Method, rt.Path, rt.Name)
+		}
+	}
+}
+
+func TestResourceHandlers(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	cases := []struct {
+		method  string
+		path    string
+		ct      string
+		body    string
+		expCode int
+		expBody string
+	}{
+		{
+			method:  "GET",
+			path:    "/widgets",
+			expCode: http.StatusOK,
+			expBody: `[{"id":1,"name":"a"},{"id":2,"name":"b"}]` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets?name=b",
+			expCode: http.StatusOK,
+			expBody: `[{"id":2,"name":"b"}]` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/1",
+			expCode: http.StatusOK,
+			expBody: `{"id":1,"name":"a"}` + "\n",
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/3",
+			expCode: http.StatusNotFound,
+		},
+		{
+			method:  "GET",
+			path:    "/widgets/x",
+			expCode: http.StatusBadRequest,
+			expBody: `{"code":400,"message":"invalid id value"}` + "\n",
+		},
+		{
+			method:  "POST",
+			path:    "/widgets",
+			body:    `[{"id":3,"name":"c","secret":"s"}]`,
+			expCode: http.StatusOK,
+			expBody: `{"number":1,"message":"Widgets saved",` +
+				`"data":[{"index":0,"status":200,"value":{"id":3,"name":"c"}}]}` + "\n",
+		},
+		{
+			method:  "POST",
+			path:    "/widgets",
+			body:    `[{"id":3,"name":"c"},{"id":4,"name":"d"}]`,
+			expCode: http.StatusOK,
+			expBody: `{"number":2,"message":"Widgets saved","data":[` +
+				`{"index":0,"status":200,"value":{"id":3,"name":"c"}},` +
+				`{"index":1,"status":200,"value":{"id":4,"name":"d"}}]}` + "\n",
+		},
+		{
+			method:  "PUT",
+			path:    "/widgets/1",
+			body:    `{"name":"d","secret":"s"}`,
+			expCode: http.StatusOK,
+			expBody: `{"value":{"id":1,"name":"d"},"number":1,"message":"Widget saved"}` + "\n",
+		},
+		{
+			method:  "PATCH",
+			path:    "/widgets/1",
+			ct:      MergePatchContentType,
+			body:    `{"name":"e"}`,
+			expCode: http.StatusOK,
+			expBody: `{"value":{"id":1,"name":"e"},"number":1,"message":"Widget saved"}` + "\n",
+		},
+		{
+			method:  "DELETE",
+			path:    "/widgets/1",
+			expCode: http.StatusOK,
+			expBody: `{"number":1,"message":"Widget deleted"}` + "\n",
+		},
+		{
+			method:  "DELETE",
+			path:    "/widgets",
+			body:    `{"name":"b"}`,
+			expCode: http.StatusOK,
+			expBody: `{"number":1,"message":"Widgets deleted"}` + "\n",
+		},
+	}
+
+	for _, c := range cases {
+		st := WidgetStore{
+			1: {ID: 1, Name: "a", Secret: "x"},
+			2: {ID: 2, Name: "b", Secret: "y"},
+		}
+
+		svr := Server{Log: lm}
+		rtr := mux.NewRouter()
+		for _, rt := range NewWidgets(&svr, st).Routes() {
+			rtr.Methods(rt.Method).Path(rt.Path).HandlerFunc(rt.HandlerFunc)
+		}
+
+		r, err := http.NewRequest(c.method, c.path, bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		if c.ct != "" {
+			r.Header.Set("Content-Type", c.ct)
+		}
+
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, r)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expBody != "" && w.Body.String() != c.expBody {
+			t.Errorf("Body expected: %v, got: %v", c.expBody, w.Body.String())
+		}
+	}
+}
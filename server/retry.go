@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy values define how failed dauth calls are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Codes       []codes.Code
+	Budget      *RetryBudget
+}
+
+// NewRetryPolicy creates and returns a pointer to a RetryPolicy value which
+// retries unavailable calls with jittered exponential backoff.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   50 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Codes:       []codes.Code{codes.Unavailable},
+		Budget:      NewRetryBudget(0.2, 10),
+	}
+}
+
+// Retryable returns whether the error has a status code which is retried.
+func (rp *RetryPolicy) Retryable(err error) bool {
+	c := status.Code(err)
+	for _, v := range rp.Codes {
+		if c == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backoff returns a random delay of up to the exponential backoff for the
+// specified zero based retry attempt.
+func (rp *RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(rp.BaseDelay) * math.Pow(2, float64(attempt))
+	if d > float64(rp.MaxDelay) {
+		d = float64(rp.MaxDelay)
+	}
+
+	if d < 1 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// RetryBudget values limit retries to a ratio of the calls made, so that
+// retries can not multiply the load on a struggling service.
+type RetryBudget struct {
+	Ratio  float64
+	Max    float64
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget creates and returns a pointer to a RetryBudget value which
+// earns ratio retries for every call, up to max retries.
+func NewRetryBudget(ratio, max float64) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, Max: max, tokens: max}
+}
+
+// Deposit records a call and adds to the available retries.
+func (rb *RetryBudget) Deposit() {
+	if rb == nil {
+		return
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens = math.Min(rb.tokens+rb.Ratio, rb.Max)
+}
+
+// Withdraw takes one retry from the budget and reports whether one was
+// available.
+func (rb *RetryBudget) Withdraw() bool {
+	if rb == nil {
+		return true
+	}
+
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.tokens < 1 {
+		return false
+	}
+
+	rb.tokens--
+	return true
+}
+
+// Breaker states.
+const (
+	BreakerClosed = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// Breaker values implement a circuit breaker which opens after a number of
+// consecutive failures and fails calls fast until the cooldown has passed.
+// A single probe call is then allowed to decide whether to close again.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	Codes     []codes.Code
+	mu        sync.Mutex
+	state     int
+	failures  int
+	opened    time.Time
+}
+
+// NewBreaker creates and returns a pointer to a Breaker value.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		Codes:     []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow reports whether a call may proceed. When it may not, the time
+// remaining until the next probe is allowed is returned.
+func (b *Breaker) Allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		wait := b.Cooldown - time.Since(b.opened)
+		if wait > 0 {
+			return wait, false
+		}
+
+		b.state = BreakerHalfOpen
+		return 0, true
+	case BreakerHalfOpen:
+		return b.Cooldown, false
+	default:
+		return 0, true
+	}
+}
+
+// Record records the result of a call allowed by the breaker.
+func (b *Breaker) Record(err error) {
+	failed := false
+	c := status.Code(err)
+	for _, v := range b.Codes {
+		if c == v {
+			failed = true
+			break
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.Threshold {
+		b.state = BreakerOpen
+		b.opened = time.Now()
+	}
+}
+
+// sleep waits for the duration and reports whether it completed before the
+// context was done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// UnavailableError values are returned for calls rejected by an open
+// circuit breaker.
+type UnavailableError struct {
+	Service    string
+	RetryAfter time.Duration
+}
+
+// Error returns the error message.
+func (e *UnavailableError) Error() string {
+	return e.Service + " service unavailable"
+}
+
+// Call invokes a dauth call using the server retry policy and circuit breaker.
+// The function is passed the context to use for the call.
+func (s *Server) Call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.Breaker != nil {
+		if wait, ok := s.Breaker.Allow(); !ok {
+			return &UnavailableError{Service: "dauth", RetryAfter: wait}
+		}
+	}
+
+	rp := s.Retry
+	if rp == nil {
+		rp = &RetryPolicy{MaxAttempts: 1}
+	}
+
+	rp.Budget.Deposit()
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || !rp.Retryable(err) || attempt+1 >= rp.MaxAttempts ||
+			!rp.Budget.Withdraw() {
+			break
+		}
+
+		if !sleep(ctx, rp.Backoff(attempt)) {
+			break
+		}
+	}
+
+	if s.Breaker != nil {
+		s.Breaker.Record(err)
+	}
+
+	return err
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerCallRetry(t *testing.T) {
+	cases := []struct {
+		errs     []error
+		expCalls int
+		expCode  codes.Code
+	}{
+		{
+			errs:     []error{status.Error(codes.Unavailable, "transport is closing"), nil},
+			expCalls: 2,
+			expCode:  codes.OK,
+		},
+		{
+			errs:     []error{status.Error(codes.NotFound, "not found"), nil},
+			expCalls: 1,
+			expCode:  codes.NotFound,
+		},
+		{
+			errs: []error{
+				status.Error(codes.Unavailable, "unavailable"),
+				status.Error(codes.Unavailable, "unavailable"),
+				status.Error(codes.Unavailable, "unavailable"),
+			},
+			expCalls: 3,
+			expCode:  codes.Unavailable,
+		},
+	}
+
+	for _, c := range cases {
+		svr := Server{Retry: NewRetryPolicy()}
+		svr.Retry.MaxAttempts = 3
+		svr.Retry.BaseDelay = time.Millisecond
+		calls := 0
+		err := svr.Call(context.Background(), func(ctx context.Context) error {
+			calls++
+			return c.errs[calls-1]
+		})
+
+		if calls != c.expCalls {
+			t.Errorf("Calls expected: %v, got: %v", c.expCalls, calls)
+		}
+
+		if status.Code(err) != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, status.Code(err))
+		}
+	}
+}
+
+func TestServerCallBreaker(t *testing.T) {
+	fr, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, Breaker: NewBreaker(2, time.Minute)}
+	fail := func(ctx context.Context) error {
+		return status.Error(codes.Unavailable, "unavailable")
+	}
+
+	cases := []struct {
+		expState int
+	}{
+		{expState: BreakerClosed},
+		{expState: BreakerOpen},
+	}
+
+	for _, c := range cases {
+		svr.Call(context.Background(), fail)
+		if svr.Breaker.State() != c.expState {
+			t.Errorf("State expected: %v, got: %v", c.expState, svr.Breaker.State())
+		}
+	}
+
+	err = svr.Call(context.Background(), func(ctx context.Context) error {
+		t.Error("Call made while breaker open")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	svr.RespondWithError(err, w, fr)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code expected: %v, got: %v", http.StatusServiceUnavailable, w.Code)
+	}
+
+	if w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After expected: %v, got: %v", "60", w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v2"
+)
+
+// RouteConfig values describe a route loaded from a routes file. The target
+// names the handler serving the route, using the targets of the built in
+// routes, such as "dauth.Users.GetByID". When the service, name or auth flag
+// are not set they are taken from the built in routes for the target. The
+// rate limit, when set, replaces the default rate limit for the route. A
+// routes file replaces every built in route, including the backend and
+// metrics routes, so it must list each route to be served.
+type RouteConfig struct {
+	Path      string     `json:"path" yaml:"path"`
+	Method    string     `json:"method" yaml:"method"`
+	Service   string     `json:"service" yaml:"service"`
+	Name      string     `json:"name" yaml:"name"`
+	Auth      *bool      `json:"auth" yaml:"auth"`
+	Timeout   string     `json:"timeout" yaml:"timeout"`
+	RateLimit *RateLimit `json:"rate_limit" yaml:"rate_limit"`
+	Target    string     `json:"target" yaml:"target"`
+}
+
+// routesFile values are the contents of a routes file.
+type routesFile struct {
+	Routes []RouteConfig `json:"routes" yaml:"routes"`
+}
+
+// routeMethods contains the methods which routes may use.
+var routeMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
+// routeVar matches the variables in a route path.
+var routeVar = regexp.MustCompile(`\{([^{}:]*)(:[^{}]*)?\}`)
+
+// pathVars returns the names of the variables in a route path.
+func pathVars(path string) map[string]bool {
+	vars := map[string]bool{}
+	for _, m := range routeVar.FindAllStringSubmatch(path, -1) {
+		vars[m[1]] = true
+	}
+
+	return vars
+}
+
+// routeMatches checks whether a route matches requests for a method and
+// path.
+func routeMatches(route Route, method, path string) bool {
+	router := mux.NewRouter().StrictSlash(true)
+	router.Methods(route.Method).Path(route.Path)
+	return router.Match(&http.Request{Method: method, URL: &url.URL{Path: path}},
+		&mux.RouteMatch{})
+}
+
+// LoadRoutes reads a YAML or JSON routes file. Files are read as JSON when
+// their extension is .json and as YAML otherwise. Unknown keys are rejected.
+func LoadRoutes(file string) ([]RouteConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rf := routesFile{}
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&rf)
+	} else {
+		err = yaml.UnmarshalStrict(data, &rf)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse routes file %s: %v", file, err)
+	}
+
+	return rf.Routes, nil
+}
+
+// ConfigRoutes returns the routes described by route configuration, with
+// their handlers taken from the built in routes for their targets.
+func (s *Server) ConfigRoutes(cfgs []RouteConfig) ([]Route, error) {
+	targets := map[string]Route{}
+	for _, route := range s.GetRoutes() {
+		if _, ok := targets[route.Target]; !ok {
+			targets[route.Target] = route
+		}
+	}
+
+	routes := []Route{}
+	errs := []string{}
+	for i, cfg := range cfgs {
+		t, ok := targets[cfg.Target]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("route %d (%s %s): unknown target %q",
+				i, cfg.Method, cfg.Path, cfg.Target))
+			continue
+		}
+
+		route := Route{
+			Service:     t.Service,
+			Name:        t.Name,
+			Path:        cfg.Path,
+			Method:      strings.ToUpper(cfg.Method),
+			Auth:        t.Auth,
+			RateLimit:   t.RateLimit,
+			Target:      cfg.Target,
+			HandlerFunc: t.HandlerFunc,
+		}
+
+		if cfg.Service != "" {
+			route.Service = cfg.Service
+		}
+
+		if cfg.Name != "" {
+			route.Name = cfg.Name
+		}
+
+		if cfg.Auth != nil {
+			route.Auth = *cfg.Auth
+		}
+
+		if cfg.Timeout != "" {
+			d, err := time.ParseDuration(cfg.Timeout)
+			if err != nil || d < 0 {
+				errs = append(errs, fmt.Sprintf("route %d (%s %s): invalid timeout %q",
+					i, cfg.Method, cfg.Path, cfg.Timeout))
+				continue
+			}
+
+			route.Timeout = d
+		}
+
+		if cfg.RateLimit != nil {
+			limit := *cfg.RateLimit
+			route.RateLimit = &limit
+		}
+
+		for v := range pathVars(t.Path) {
+			if !pathVars(cfg.Path)[v] {
+				errs = append(errs, fmt.Sprintf("route %d (%s %s): path must contain {%s}",
+					i, cfg.Method, cfg.Path, v))
+			}
+		}
+
+		routes = append(routes, route)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New("invalid routes: " + strings.Join(errs, "; "))
+	}
+
+	return routes, nil
+}
+
+// ValidateRoutes checks that routes have valid paths and methods, a handler,
+// a service and name when they require authorization, valid timeouts and rate
+// limits, and that no two routes share a method and path. Since routes are
+// matched in order, a route with a literal path is invalid when an earlier
+// route with variables in its path matches it. All invalid routes are
+// reported.
+func ValidateRoutes(routes []Route) error {
+	errs := []string{}
+	seen := map[string]int{}
+	templated := []int{}
+	for i, route := range routes {
+		prefix := fmt.Sprintf("route %d (%s %s)", i, route.Method, route.Path)
+		valid := false
+		if !strings.HasPrefix(route.Path, "/") {
+			errs = append(errs, prefix+": path must begin with /")
+		} else if err := mux.NewRouter().NewRoute().Path(route.Path).GetError(); err != nil {
+			errs = append(errs, prefix+": "+err.Error())
+		} else {
+			valid = true
+		}
+
+		if !routeMethods[route.Method] {
+			errs = append(errs, prefix+": invalid method")
+		}
+
+		if route.HandlerFunc == nil {
+			errs = append(errs, prefix+": no handler")
+		}
+
+		if route.Auth && (route.Service == "" || route.Name == "") {
+			errs = append(errs, prefix+": service and name are required for authorization")
+		}
+
+		if route.Timeout < 0 {
+			errs = append(errs, prefix+": invalid timeout")
+		}
+
+		if route.RateLimit != nil && (route.RateLimit.Rate < 0 || route.RateLimit.Burst < 0) {
+			errs = append(errs, prefix+": invalid rate limit")
+		}
+
+		key := route.Method + " " + route.Path
+		if j, ok := seen[key]; ok {
+			errs = append(errs, fmt.Sprintf("%s: duplicates route %d", prefix, j))
+			continue
+		}
+
+		seen[key] = i
+		if !valid {
+			continue
+		}
+
+		if len(pathVars(route.Path)) > 0 {
+			templated = append(templated, i)
+			continue
+		}
+
+		for _, j := range templated {
+			if routeMatches(routes[j], route.Method, route.Path) {
+				errs = append(errs, fmt.Sprintf("%s: is matched by route %d", prefix, j))
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid routes: " + strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Routes returns the routes served by the server, which are read from the
+// routes file when one is configured, and validates them. The routes in a
+// routes file replace all of the built in routes.
+func (s *Server) Routes() ([]Route, error) {
+	routes := s.GetRoutes()
+	if s.RoutesFile != "" {
+		cfgs, err := LoadRoutes(s.RoutesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if routes, err = s.ConfigRoutes(cfgs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateRoutes(routes); err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
+
+// ServeHTTP serves requests using the current router, which may be replaced
+// while requests are being served.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := s.handler.Load().(http.Handler)
+	if !ok {
+		s.NotFoundHandler(w, r)
+		return
+	}
+
+	h.ServeHTTP(w, r)
+}
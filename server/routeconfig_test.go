@@ -0,0 +1,345 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	svr := Server{}
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	cases := []struct {
+		routes []Route
+		expErr string
+	}{
+		{routes: svr.GetRoutes()},
+		{
+			routes: []Route{{Path: "/dauth/tokens}", Method: "DELETE", HandlerFunc: h}},
+			expErr: "unbalanced braces",
+		},
+		{
+			routes: []Route{{Path: "dauth/tokens", Method: "GET", HandlerFunc: h}},
+			expErr: "path must begin with /",
+		},
+		{
+			routes: []Route{{Path: "/dauth/tokens/{}", Method: "GET", HandlerFunc: h}},
+			expErr: "missing name or pattern",
+		},
+		{
+			routes: []Route{{Path: "/dauth/tokens", Method: "FETCH", HandlerFunc: h}},
+			expErr: "invalid method",
+		},
+		{
+			routes: []Route{{Path: "/dauth/tokens", Method: "GET"}},
+			expErr: "no handler",
+		},
+		{
+			routes: []Route{{Path: "/dauth/tokens", Method: "GET", Auth: true,
+				Service: "dauth", HandlerFunc: h}},
+			expErr: "service and name are required",
+		},
+		{
+			routes: []Route{{Path: "/dauth/tokens", Method: "GET", HandlerFunc: h,
+				RateLimit: &RateLimit{Rate: -1}}},
+			expErr: "invalid rate limit",
+		},
+		{
+			routes: []Route{
+				{Path: "/dauth/tokens", Method: "GET", HandlerFunc: h},
+				{Path: "/dauth/tokens", Method: "GET", HandlerFunc: h},
+			},
+			expErr: "route 1 (GET /dauth/tokens): duplicates route 0",
+		},
+		{
+			routes: []Route{
+				{Path: "/dauth/tokens/{id}", Method: "DELETE", HandlerFunc: h},
+				{Path: "/dauth/tokens/old", Method: "DELETE", HandlerFunc: h},
+			},
+			expErr: "route 1 (DELETE /dauth/tokens/old): is matched by route 0",
+		},
+		{
+			routes: []Route{
+				{Path: "/dauth/tokens/old", Method: "DELETE", HandlerFunc: h},
+				{Path: "/dauth/tokens/{id}", Method: "DELETE", HandlerFunc: h},
+				{Path: "/dauth/tokens/{id}", Method: "GET", HandlerFunc: h},
+				{Path: "/dauth/tokens/old", Method: "GET", HandlerFunc: h},
+			},
+			expErr: "route 3 (GET /dauth/tokens/old): is matched by route 2",
+		},
+		{
+			routes: []Route{
+				{Path: "/dauth/tokens/{id:[0-9]+}", Method: "DELETE", HandlerFunc: h},
+				{Path: "/dauth/tokens/old", Method: "DELETE", HandlerFunc: h},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		err := ValidateRoutes(c.routes)
+		if c.expErr == "" {
+			if err != nil {
+				t.Errorf("Error expected: %v, got: %v", nil, err)
+			}
+
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.expErr) {
+			t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+		}
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	cases := []struct {
+		file     string
+		data     string
+		expErr   bool
+		expPath  string
+		expAuth  bool
+		expTimer string
+		expLimit *RateLimit
+	}{
+		{
+			file: "routes.yaml",
+			data: "routes:\n" +
+				"  - path: /v2/users\n" +
+				"    method: GET\n" +
+				"    auth: false\n" +
+				"    timeout: 5s\n" +
+				"    rate_limit:\n" +
+				"      rate: 2.5\n" +
+				"      burst: 10\n" +
+				"    target: dauth.Users.Get\n",
+			expPath:  "/v2/users",
+			expTimer: "5s",
+			expLimit: &RateLimit{Rate: 2.5, Burst: 10},
+		},
+		{
+			file:     "routes.json",
+			data:     `{"routes":[{"path":"/v2/users","method":"GET","auth":true,"target":"dauth.Users.Get"}]}`,
+			expPath:  "/v2/users",
+			expAuth:  true,
+			expTimer: "",
+		},
+		{
+			file: "limit.json",
+			data: `{"routes":[{"path":"/v2/users","method":"GET","auth":true,` +
+				`"rate_limit":{"rate":1,"burst":3},"target":"dauth.Users.Get"}]}`,
+			expPath:  "/v2/users",
+			expAuth:  true,
+			expLimit: &RateLimit{Rate: 1, Burst: 3},
+		},
+		{
+			file:   "limit.yaml",
+			data:   "routes:\n  - path: /v2/users\n    rate_limit:\n      per: 1\n",
+			expErr: true,
+		},
+		{
+			file:   "unknown.yaml",
+			data:   "routes:\n  - path: /v2/users\n    handler: GetUsers\n",
+			expErr: true,
+		},
+		{
+			file:   "unknown.json",
+			data:   `{"routes":[{"path":"/v2/users","handler":"GetUsers"}]}`,
+			expErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		file := filepath.Join(dir, c.file)
+		if err := ioutil.WriteFile(file, []byte(c.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		cfgs, err := LoadRoutes(file)
+		if c.expErr {
+			if err == nil {
+				t.Errorf("Error expected for %v", c.file)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(cfgs) != 1 {
+			t.Fatalf("Routes expected: %v, got: %v", 1, len(cfgs))
+		}
+
+		if cfgs[0].Path != c.expPath {
+			t.Errorf("Path expected: %v, got: %v", c.expPath, cfgs[0].Path)
+		}
+
+		if cfgs[0].Auth == nil || *cfgs[0].Auth != c.expAuth {
+			t.Errorf("Auth expected: %v, got: %v", c.expAuth, cfgs[0].Auth)
+		}
+
+		if cfgs[0].Timeout != c.expTimer {
+			t.Errorf("Timeout expected: %v, got: %v", c.expTimer, cfgs[0].Timeout)
+		}
+
+		if (c.expLimit == nil) != (cfgs[0].RateLimit == nil) ||
+			c.expLimit != nil && *c.expLimit != *cfgs[0].RateLimit {
+			t.Errorf("RateLimit expected: %v, got: %v", c.expLimit, cfgs[0].RateLimit)
+		}
+	}
+}
+
+func TestServerConfigRoutes(t *testing.T) {
+	svr := Server{}
+	off := false
+	cases := []struct {
+		cfg        RouteConfig
+		expErr     string
+		expName    string
+		expService string
+		expAuth    bool
+		expLimit   *RateLimit
+	}{
+		{
+			cfg:        RouteConfig{Path: "/v2/users/{id}", Method: "get", Target: "dauth.Users.GetByID"},
+			expName:    "GetUsers",
+			expService: "dauth",
+			expAuth:    true,
+		},
+		{
+			cfg: RouteConfig{Path: "/v2/users", Method: "GET", Target: "dauth.Users.Get",
+				Service: "dapi", Name: "ListUsers", Auth: &off},
+			expName:    "ListUsers",
+			expService: "dapi",
+		},
+		{
+			cfg: RouteConfig{Path: "/v2/users", Method: "GET", Target: "dauth.Users.Get",
+				RateLimit: &RateLimit{Rate: 5, Burst: 10}},
+			expName:    "GetUsers",
+			expService: "dauth",
+			expAuth:    true,
+			expLimit:   &RateLimit{Rate: 5, Burst: 10},
+		},
+		{
+			cfg:    RouteConfig{Path: "/v2/users", Method: "GET", Target: "dauth.Users.List"},
+			expErr: `unknown target "dauth.Users.List"`,
+		},
+		{
+			cfg:    RouteConfig{Path: "/v2/users", Method: "GET", Target: "dauth.Users.GetByID"},
+			expErr: "path must contain {id}",
+		},
+		{
+			cfg: RouteConfig{Path: "/v2/users", Method: "GET", Target: "dauth.Users.Get",
+				Timeout: "soon"},
+			expErr: `invalid timeout "soon"`,
+		},
+	}
+
+	for _, c := range cases {
+		routes, err := svr.ConfigRoutes([]RouteConfig{c.cfg})
+		if c.expErr != "" {
+			if err == nil || !strings.Contains(err.Error(), c.expErr) {
+				t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rt := routes[0]
+		if rt.Method != "GET" || rt.HandlerFunc == nil {
+			t.Errorf("Route expected: GET with handler, got: %v %v", rt.Method,
+				rt.HandlerFunc != nil)
+		}
+
+		if rt.Name != c.expName || rt.Service != c.expService || rt.Auth != c.expAuth {
+			t.Errorf("Route expected: %v %v %v, got: %v %v %v", c.expService, c.expName,
+				c.expAuth, rt.Service, rt.Name, rt.Auth)
+		}
+
+		if (c.expLimit == nil) != (rt.RateLimit == nil) ||
+			c.expLimit != nil && *c.expLimit != *rt.RateLimit {
+			t.Errorf("RateLimit expected: %v, got: %v", c.expLimit, rt.RateLimit)
+		}
+	}
+}
+
+func TestServerInitRouterReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "routes.yaml")
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm, RoutesFile: file}
+	cases := []struct {
+		data    string
+		expErr  bool
+		path    string
+		expCode int
+	}{
+		{
+			data:    "routes:\n  - path: /v1/users/{id}\n    method: GET\n    auth: false\n    target: dauth.Users.GetByID\n",
+			path:    "/v1/users/1",
+			expCode: http.StatusOK,
+		},
+		{
+			data:    "routes:\n  - path: /v2/users}\n    method: GET\n    auth: false\n    target: dauth.Users.Get\n",
+			expErr:  true,
+			path:    "/v1/users/1",
+			expCode: http.StatusOK,
+		},
+		{
+			data:    "routes:\n  - path: /v2/users/{id}\n    method: GET\n    auth: false\n    target: dauth.Users.GetByID\n",
+			path:    "/v1/users/1",
+			expCode: http.StatusNotFound,
+		},
+		{
+			path:    "/v2/users/1",
+			expCode: http.StatusOK,
+		},
+	}
+
+	for _, c := range cases {
+		if c.data != "" {
+			if err := ioutil.WriteFile(file, []byte(c.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			err := svr.InitRouter()
+			if c.expErr != (err != nil) {
+				t.Errorf("Error expected: %v, got: %v", c.expErr, err)
+			}
+		}
+
+		r, err := http.NewRequest("GET", c.path, nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		w := httptest.NewRecorder()
+		svr.ServeHTTP(w, r)
+		if w.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+	}
+}
@@ -2,30 +2,48 @@ package server
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/dhaifley/dlib/dauth"
 	"github.com/gorilla/mux"
 )
 
-// Route type defines an api route for use by the router.
+// Route type defines an api route for use by the router. Target names the
+// handler serving the route, so that it can be used in a routes file.
 type Route struct {
 	Service     string
 	Name        string
 	Path        string
 	Method      string
 	Auth        bool
+	Timeout     time.Duration
+	RateLimit   *RateLimit
+	Target      string
 	HandlerFunc http.HandlerFunc
 }
 
 // InitRouter initializes the server router.
 // It configures and attaches all required middleware and attaches the routes
-// specified in the routes.go file.
-func (s *Server) InitRouter() {
-	s.Router = mux.NewRouter().StrictSlash(true)
-	for _, route := range s.GetRoutes() {
+// specified in the routes.go file, or in the routes file when one is set.
+// Each route is given a request deadline of its own Timeout, or the server
+// Timeout when the route does not set one. When CORS is configured, preflight
+// requests are answered for every path. If the routes are invalid an error is
+// returned and the current router is kept, so InitRouter may be called again
+// to reload the routes while the server is running.
+func (s *Server) InitRouter() error {
+	routes, err := s.Routes()
+	if err != nil {
+		return err
+	}
+
+	router := mux.NewRouter().StrictSlash(true)
+	paths := []string{}
+	methods := map[string][]string{}
+	for _, route := range routes {
 		var handler http.Handler
 		handler = route.HandlerFunc
 		handler = s.Header(handler)
+		handler = s.RateLimit(handler, route)
 		if route.Auth {
 			handler = s.AuthHandler(handler, &dauth.Perm{
 				Service: route.Service,
@@ -33,33 +51,87 @@ func (s *Server) InitRouter() {
 			})
 		}
 
-		s.Router.
+		timeout := s.Timeout
+		if route.Timeout != 0 {
+			timeout = route.Timeout
+		}
+
+		handler = s.Deadline(handler, timeout)
+		handler = s.Instrument(handler, route)
+		handler = s.Trace(handler, route)
+		handler = s.CORS(handler)
+		handler = s.Logger(handler, route)
+
+		router.
 			Methods(route.Method).
 			Path(route.Path).
 			Name(route.Name).
 			Handler(handler)
+		if _, ok := methods[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+
+		methods[route.Path] = append(methods[route.Path], route.Method)
+	}
+
+	if s.CORSConfig != nil {
+		for _, path := range paths {
+			router.
+				Methods("OPTIONS").
+				Path(path).
+				Handler(s.Logger(s.Preflight(methods[path]),
+					Route{Service: "dapi", Name: "preflight"}))
+		}
 	}
 
-	s.Router.NotFoundHandler = http.HandlerFunc(s.NotFoundHandler)
+	router.NotFoundHandler = s.Logger(http.HandlerFunc(s.NotFoundHandler),
+		Route{Service: "dapi", Name: "notfound"})
+	s.Router = router
+	s.handler.Store(http.Handler(router))
+	return nil
 }
 
 // GetRoutes returns all routes for the server.
+// The routes for dauth resources are generated from their resource values,
+// and those for other services from the methods of their backends.
+// The metrics route is included when metrics are enabled and are not served
+// on a separate listener.
 func (s *Server) GetRoutes() []Route {
-	return []Route{
+	routes := []Route{
 		Route{
 			Service:     "dapi",
 			Name:        "index",
 			Path:        "/",
 			Method:      "GET",
 			Auth:        false,
+			Target:      "dapi.GetIndex",
 			HandlerFunc: s.GetIndex,
 		},
+		Route{
+			Service:     "dapi",
+			Name:        "errors",
+			Path:        "/errors",
+			Method:      "GET",
+			Auth:        false,
+			Target:      "dapi.GetErrors",
+			HandlerFunc: s.GetErrors,
+		},
+		Route{
+			Service:     "dapi",
+			Name:        "error",
+			Path:        "/errors/{code}",
+			Method:      "GET",
+			Auth:        false,
+			Target:      "dapi.GetErrors",
+			HandlerFunc: s.GetErrors,
+		},
 		Route{
 			Service:     "dapi",
 			Name:        "docs",
 			Path:        "/docs",
 			Method:      "GET",
 			Auth:        false,
+			Target:      "dapi.GetDocs",
 			HandlerFunc: s.GetDocs,
 		},
 		Route{
@@ -68,47 +140,35 @@ func (s *Server) GetRoutes() []Route {
 			Path:        "/favicon.ico",
 			Method:      "GET",
 			Auth:        false,
+			Target:      "dapi.GetIcon",
 			HandlerFunc: s.GetIcon,
 		},
 		Route{
-			Service:     "dauth",
-			Name:        "GetTokens",
-			Path:        "/dauth/tokens",
+			Service:     "dapi",
+			Name:        "healthz",
+			Path:        "/healthz",
 			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetTokens,
+			Auth:        false,
+			Target:      "dapi.GetHealth",
+			HandlerFunc: s.GetHealth,
 		},
 		Route{
-			Service:     "dauth",
-			Name:        "GetTokens",
-			Path:        "/dauth/tokens/{id}",
+			Service:     "dapi",
+			Name:        "readyz",
+			Path:        "/readyz",
 			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetTokenByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveTokens",
-			Path:        "/dauth/tokens",
-			Method:      "POST",
-			Auth:        true,
-			HandlerFunc: s.PostTokens,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveTokens",
-			Path:        "/dauth/tokens/{id}",
-			Method:      "PUT",
-			Auth:        true,
-			HandlerFunc: s.PutTokenByID,
+			Auth:        false,
+			Target:      "dapi.GetReady",
+			HandlerFunc: s.GetReady,
 		},
 		Route{
-			Service:     "dauth",
-			Name:        "DeleteTokens",
-			Path:        "/dauth/tokens/old",
-			Method:      "DELETE",
+			Service:     "dapi",
+			Name:        "AuthCache",
+			Path:        "/dapi/authcache",
+			Method:      "GET",
 			Auth:        true,
-			HandlerFunc: s.DeleteTokensOld,
+			Target:      "dapi.GetAuthCache",
+			HandlerFunc: s.GetAuthCache,
 		},
 		Route{
 			Service:     "dauth",
@@ -116,174 +176,16 @@ func (s *Server) GetRoutes() []Route {
 			Path:        "/dauth/tokens/old/{age}",
 			Method:      "DELETE",
 			Auth:        true,
+			Target:      "dauth.DeleteTokensOld",
 			HandlerFunc: s.DeleteTokensOld,
 		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteTokens",
-			Path:        "/dauth/tokens/{id}",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteTokenByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteTokens",
-			Path:        "/dauth/tokens}",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteTokens,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetUsers",
-			Path:        "/dauth/users",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetUsers,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetUsers",
-			Path:        "/dauth/users/{id}",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetUserByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveUsers",
-			Path:        "/dauth/users",
-			Method:      "POST",
-			Auth:        true,
-			HandlerFunc: s.PostUsers,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveUsers",
-			Path:        "/dauth/users/{id}",
-			Method:      "PUT",
-			Auth:        true,
-			HandlerFunc: s.PutUserByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteUsers",
-			Path:        "/dauth/users/{id}",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteUserByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteUsers",
-			Path:        "/dauth/users",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteUsers,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetPerms",
-			Path:        "/dauth/perms",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetPerms,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetPerms",
-			Path:        "/dauth/perms/{id}",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetPermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SavePerms",
-			Path:        "/dauth/perms",
-			Method:      "POST",
-			Auth:        true,
-			HandlerFunc: s.PostPerms,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SavePerms",
-			Path:        "/dauth/perms/{id}",
-			Method:      "PUT",
-			Auth:        true,
-			HandlerFunc: s.PutPermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeletePerms",
-			Path:        "/dauth/perms/{id}",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeletePermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeletePerms",
-			Path:        "/dauth/perms",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeletePerms,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetUserPerms",
-			Path:        "/dauth/userperms",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetUserPerms,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "GetUserPerms",
-			Path:        "/dauth/userperms/{id}",
-			Method:      "GET",
-			Auth:        true,
-			HandlerFunc: s.GetUserPermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveUserPerms",
-			Path:        "/dauth/userperms",
-			Method:      "POST",
-			Auth:        true,
-			HandlerFunc: s.PostUserPerms,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "SaveUserPerms",
-			Path:        "/dauth/userperms/{id}",
-			Method:      "PUT",
-			Auth:        true,
-			HandlerFunc: s.PutUserPermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteUserPerms",
-			Path:        "/dauth/userperms/{id}",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteUserPermByID,
-		},
-		Route{
-			Service:     "dauth",
-			Name:        "DeleteUserPerms",
-			Path:        "/dauth/userperms",
-			Method:      "DELETE",
-			Auth:        true,
-			HandlerFunc: s.DeleteUserPerms,
-		},
 		Route{
 			Service:     "dauth",
 			Name:        "Auth",
 			Path:        "/dauth/auth",
 			Method:      "GET",
 			Auth:        true,
+			Target:      "dauth.Authenticate",
 			HandlerFunc: s.Authenticate,
 		},
 		Route{
@@ -292,6 +194,7 @@ func (s *Server) GetRoutes() []Route {
 			Path:        "/dauth/login",
 			Method:      "POST",
 			Auth:        false,
+			Target:      "dauth.Login",
 			HandlerFunc: s.Login,
 		},
 		Route{
@@ -300,7 +203,28 @@ func (s *Server) GetRoutes() []Route {
 			Path:        "/dauth/logout",
 			Method:      "POST",
 			Auth:        false,
+			Target:      "dauth.Logout",
 			HandlerFunc: s.Logout,
 		},
 	}
+
+	routes = append(routes, s.Tokens().Routes()...)
+	routes = append(routes, s.Users().Routes()...)
+	routes = append(routes, s.Perms().Routes()...)
+	routes = append(routes, s.UserPerms().Routes()...)
+	routes = append(routes, s.BackendRoutes()...)
+
+	if s.Metrics != nil && !s.SeparateMetrics {
+		routes = append(routes, Route{
+			Service:     "dapi",
+			Name:        "metrics",
+			Path:        "/metrics",
+			Method:      "GET",
+			Auth:        false,
+			Target:      "dapi.GetMetrics",
+			HandlerFunc: s.GetMetrics,
+		})
+	}
+
+	return routes
 }
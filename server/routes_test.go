@@ -38,7 +38,10 @@ func TestServerInitRouter(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		c.server.InitRouter()
+		if err := c.server.InitRouter(); err != nil {
+			t.Fatal(err)
+		}
+
 		url, err := c.server.Router.Get(c.name).URL(c.params...)
 		if err != nil {
 			t.Fatal("Unable to parse URL", c)
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/dhaifley/dapi/lib"
@@ -14,42 +15,74 @@ import (
 	"github.com/dhaifley/dlib/ptypes"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Server values implement API server functionality.
 type Server struct {
-	Log    logrus.FieldLogger
-	Router *mux.Router
-	Auth   ptypes.AuthClient
+	Log              logrus.FieldLogger
+	Router           *mux.Router
+	RoutesFile       string
+	Auth             ptypes.AuthClient
+	Timeout          time.Duration
+	Retry            *RetryPolicy
+	Breaker          *Breaker
+	AuthConn         ConnState
+	Backends         []*Backend
+	ReadyProbe       bool
+	Limiter          *RateLimiter
+	CORSConfig       *CORSConfig
+	PageLimit        int
+	MaxPageLimit     int
+	MaxBodySize      int64
+	AuthCache        *AuthCache
+	Metrics          *Metrics
+	Tracing          trace.TracerProvider
+	SeparateMetrics  bool
+	DisableAccessLog bool
+	handler          atomic.Value
 }
 
 // CheckAuth authenticates the provided token using the dauth service.
-func (s *Server) CheckAuth(req *ptypes.AuthRequest) <-chan *dlib.Result {
+// Decisions are served from the authorization cache when one is configured.
+func (s *Server) CheckAuth(ctx context.Context, req *ptypes.AuthRequest) <-chan *dlib.Result {
 	ch := make(chan *dlib.Result)
 	go func() {
 		defer close(ch)
-		res, err := s.Auth.Auth(context.Background(), req)
-		retry := 0
-		for retry < 10 && err != nil {
-			if err.Error() != "rpc error: code = Unavailable desc = transport is closing" {
+		ctx, span := s.startSpan(ctx, "CheckAuth")
+		defer span.End()
+		res, cached := s.AuthCache.Get(req)
+		span.SetAttributes(attribute.Bool("dapi.auth.cached", cached))
+		if !cached {
+			if err := s.Call(ctx, func(ctx context.Context) error {
+				var err error
+				res, err = s.Auth.Auth(ctx, req)
+				return err
+			}); err != nil {
+				s.Metrics.authCheck("error", false)
+				span.RecordError(err)
+				span.SetStatus(otelcodes.Error, err.Error())
 				ch <- dlib.NewErrorResult(err)
 				return
 			}
 
-			res, err = s.Auth.Auth(context.Background(), req)
-			retry++
+			s.AuthCache.Set(req, res)
 		}
 
-		if retry >= 10 || res == nil {
-			ch <- dlib.NewErrorResult(err)
-			return
-		}
-
-		if !res.Ok {
+		if res == nil || !res.Ok {
+			s.Metrics.authCheck("denied", cached)
+			span.SetAttributes(attribute.String("dapi.auth.outcome", "denied"))
 			ch <- dlib.NewErrorResult(dlib.NewError(
 				http.StatusUnauthorized, "unauthorized user"))
+			return
 		}
 
+		s.Metrics.authCheck("allowed", cached)
+		span.SetAttributes(attribute.String("dapi.auth.outcome", "allowed"))
 		ch <- dlib.NewResult(req, res, "result", 0, "authentication successful", nil, nil)
 	}()
 
@@ -59,30 +92,118 @@ func (s *Server) CheckAuth(req *ptypes.AuthRequest) <-chan *dlib.Result {
 // AuthHandler wraps an http handler function with authentication verification.
 func (s *Server) AuthHandler(handler http.Handler, perm *dauth.Perm) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, login, err := s.RequestToken(r)
+		if err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
 		pathparts := strings.Split(r.URL.Path, "/")
-		if r.Header.Get("Token") == "" || len(pathparts) < 2 {
+		if token == "" || len(pathparts) < 2 {
 			s.RespondWithError(dlib.NewError(http.StatusUnauthorized, "unauthorized request"), w, r)
 			return
 		}
 
+		if login {
+			defer s.releaseToken(r.Context(), token)
+		}
+
 		preq := perm.ToRequest()
 		areq := ptypes.AuthRequest{
-			Token: &ptypes.TokenRequest{Token: r.Header.Get("Token")},
+			Token: &ptypes.TokenRequest{Token: token},
 			Perm:  &preq,
 		}
 
-		ac := s.CheckAuth(&areq)
+		ac := s.CheckAuth(r.Context(), &areq)
 		for ar := range ac {
 			if ar.Err != nil {
 				s.RespondWithError(ar.Err, w, r)
 				return
 			}
+
+			v, ok := ar.Val.(*ptypes.AuthResponse)
+			if ri := GetRequestInfo(r.Context()); ok && ri != nil && v.User != nil {
+				ri.User = v.User.User
+			}
 		}
 
 		handler.ServeHTTP(w, r)
 	})
 }
 
+// RequestToken returns the API token used to authenticate a request.
+// The token is read from the legacy Token header, or from an Authorization
+// header using the Bearer scheme. Credentials sent using the Basic scheme are
+// exchanged for a new token by logging in to the dauth service, in which case
+// login is returned as true. These logins are subject to the login rate limit.
+func (s *Server) RequestToken(r *http.Request) (string, bool, error) {
+	if token := r.Header.Get("Token"); token != "" {
+		return token, false, nil
+	}
+
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 {
+		return "", false, nil
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "bearer":
+		return strings.TrimSpace(parts[1]), false, nil
+	case "basic":
+		user, pass, ok := r.BasicAuth()
+		if !ok || user == "" || pass == "" {
+			return "", false, dlib.NewError(http.StatusUnauthorized,
+				"invalid basic credentials")
+		}
+
+		if err := s.LoginLimit(r, user); err != nil {
+			return "", false, err
+		}
+
+		u := dauth.User{User: user, Pass: pass}
+		req := u.ToRequest()
+		var res *ptypes.TokenResponse
+		if err := s.Call(r.Context(), func(ctx context.Context) error {
+			var err error
+			res, err = s.Auth.Login(ctx, &req)
+			return err
+		}); err != nil {
+			s.loginFailed(r, user, err)
+			switch status.Code(err) {
+			case codes.Unauthenticated, codes.PermissionDenied,
+				codes.NotFound, codes.InvalidArgument:
+				return "", false, dlib.NewError(http.StatusUnauthorized,
+					"unauthorized request")
+			}
+
+			return "", false, err
+		}
+
+		if res == nil || res.Token == "" {
+			return "", false, dlib.NewError(http.StatusUnauthorized,
+				"unauthorized request")
+		}
+
+		return res.Token, true, nil
+	}
+
+	return "", false, nil
+}
+
+// releaseToken destroys a token obtained by a Basic scheme login once the
+// request it was created for has been served.
+func (s *Server) releaseToken(ctx context.Context, token string) {
+	req := ptypes.TokenRequest{Token: token}
+	if err := s.Call(ctx, func(ctx context.Context) error {
+		_, err := s.Auth.Logout(ctx, &req)
+		return err
+	}); err != nil {
+		s.Log.Error(err)
+	}
+
+	s.AuthCache.InvalidateToken(token)
+}
+
 // Header wraps a handler function to set default header values.
 func (s *Server) Header(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -91,45 +212,106 @@ func (s *Server) Header(handler http.Handler) http.Handler {
 	})
 }
 
+// Deadline wraps a handler function with a request context deadline.
+// A zero or negative duration leaves the request context unchanged.
+func (s *Server) Deadline(handler http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d <= 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // Logger wraps a handler function with logging functionality.
-func (s *Server) Logger(handler http.Handler) http.Handler {
+// It assigns each request an ID, using the inbound X-Request-ID header when
+// one is provided, and returns it in the response. An access log line is
+// written once the request is processed, unless access logging is disabled.
+func (s *Server) Logger(handler http.Handler, route Route) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		handler.ServeHTTP(w, r)
+		ri := RequestInfo{
+			ID:      requestID(r),
+			Name:    route.Name,
+			Service: route.Service,
+			Remote:  r.RemoteAddr,
+		}
+
+		w.Header().Set(RequestIDHeader, ri.ID)
+		rw := &responseWriter{ResponseWriter: w}
+		handler.ServeHTTP(rw, r.WithContext(WithRequestInfo(r.Context(), &ri)))
+		if s.DisableAccessLog {
+			return
+		}
+
 		s.Log.WithFields(logrus.Fields{
-			"method":  r.Method,
-			"uri":     r.RequestURI,
-			"remote":  r.RemoteAddr,
-			"elapsed": time.Since(start).String(),
+			"method":     r.Method,
+			"uri":        r.RequestURI,
+			"remote":     r.RemoteAddr,
+			"elapsed":    time.Since(start).String(),
+			"status":     rw.Status(),
+			"size":       rw.size,
+			"route":      ri.Name,
+			"service":    ri.Service,
+			"user":       ri.User,
+			"request_id": ri.ID,
 		}).Info("Request processed")
 	})
 }
 
 // RespondWithError responds to the current request with a standard error response.
+// Requests which accept problem details are sent an RFC 7807 response.
 func (s *Server) RespondWithError(err error, w http.ResponseWriter, r *http.Request) {
-	s.Log.WithFields(logrus.Fields{
-		"method": r.Method,
-		"uri":    r.RequestURI,
-		"remote": r.RemoteAddr,
-	}).Error(err)
+	s.logError(err, r)
+	if AcceptsProblem(r) {
+		p := *ToProblem(w, err)
+		p.Instance = r.URL.Path
+		if ri := GetRequestInfo(r.Context()); ri != nil {
+			p.RequestID = ri.ID
+		}
 
-	switch v := err.(type) {
-	case *dlib.Error:
-		w.WriteHeader(v.Code)
-		if err := json.NewEncoder(w).Encode(v); err != nil {
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(p.Status)
+		if err := json.NewEncoder(w).Encode(p); err != nil {
 			s.Log.Error(err)
 		}
 
 		return
-	default:
-		w.WriteHeader(http.StatusInternalServerError)
-		if err := json.NewEncoder(w).Encode(dlib.Error{
-			Code: http.StatusInternalServerError,
-			Msg:  v.Error(),
-		}); err != nil {
-			s.Log.Error(err)
-		}
 	}
+
+	e := errorValue(w, err)
+	w.WriteHeader(e.Code)
+	var v interface{} = e
+	if p, ok := err.(*Problem); ok && len(p.Errors) > 0 {
+		v = struct {
+			Code   int          `json:"code"`
+			Msg    string       `json:"message"`
+			Errors []FieldError `json:"errors"`
+		}{e.Code, e.Msg, p.Errors}
+	}
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.Log.Error(err)
+	}
+}
+
+// logError logs an error which occurred while processing a request.
+func (s *Server) logError(err error, r *http.Request) {
+	fields := logrus.Fields{
+		"method": r.Method,
+		"uri":    r.RequestURI,
+		"remote": r.RemoteAddr,
+	}
+
+	if ri := GetRequestInfo(r.Context()); ri != nil {
+		fields["request_id"] = ri.ID
+	}
+
+	s.Log.WithFields(fields).Error(err)
 }
 
 // RespondNotFound responds to the current request with a 404 not found error.
@@ -363,6 +363,88 @@ func TestServerAuthHandler(t *testing.T) {
 	}
 }
 
+type RecordingAuthClient struct {
+	FakeAuthClient
+	tokens  []string
+	logouts int
+}
+
+func (fc *RecordingAuthClient) Auth(ctx context.Context, in *ptypes.AuthRequest, opts ...grpc.CallOption) (*ptypes.AuthResponse, error) {
+	fc.tokens = append(fc.tokens, in.Token.Token)
+	return fc.FakeAuthClient.Auth(ctx, in, opts...)
+}
+
+func (fc *RecordingAuthClient) Logout(ctx context.Context, in *ptypes.TokenRequest, opts ...grpc.CallOption) (*ptypes.TokenResponse, error) {
+	fc.logouts++
+	return fc.FakeAuthClient.Logout(ctx, in, opts...)
+}
+
+func TestServerAuthHandlerSchemes(t *testing.T) {
+	cases := []struct {
+		header     string
+		value      string
+		expCode    int
+		expToken   string
+		expLogouts int
+	}{
+		{
+			header:   "Token",
+			value:    "legacy",
+			expCode:  http.StatusOK,
+			expToken: "legacy",
+		},
+		{
+			header:   "Authorization",
+			value:    "Bearer bearer",
+			expCode:  http.StatusOK,
+			expToken: "bearer",
+		},
+		{
+			header:     "Authorization",
+			value:      "Basic dGVzdHVzZXI6dGVzdHBhc3M=",
+			expCode:    http.StatusOK,
+			expToken:   "test",
+			expLogouts: 1,
+		},
+		{
+			header:  "Authorization",
+			value:   "Basic dGVzdHVzZXI6",
+			expCode: http.StatusUnauthorized,
+		},
+		{
+			header:  "Authorization",
+			value:   "Digest test",
+			expCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/dauth/users", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fc := RecordingAuthClient{}
+		lm, _ := test.NewNullLogger()
+		svr := Server{Auth: &fc, Log: lm}
+		fh := FakeHandler{false}
+		w := httptest.NewRecorder()
+		fr.Header.Set(c.header, c.value)
+		svr.AuthHandler(fh, &dauth.Perm{Service: "test", Name: "test"}).ServeHTTP(w, fr)
+		if w.Code != c.expCode {
+			t.Errorf("Status Code expected: %v, got: %v", c.expCode, w.Code)
+		}
+
+		if c.expToken != "" && (len(fc.tokens) != 1 || fc.tokens[0] != c.expToken) {
+			t.Errorf("Token expected: %v, got: %v", c.expToken, fc.tokens)
+		}
+
+		if fc.logouts != c.expLogouts {
+			t.Errorf("Logouts expected: %v, got: %v", c.expLogouts, fc.logouts)
+		}
+	}
+}
+
 func TestServerHeader(t *testing.T) {
 	fr, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -397,6 +479,46 @@ func TestServerHeader(t *testing.T) {
 	}
 }
 
+func TestServerDeadline(t *testing.T) {
+	fr, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	s := Server{}
+	cases := []struct {
+		w       *httptest.ResponseRecorder
+		r       *http.Request
+		timeout time.Duration
+		exp     bool
+	}{
+		{
+			w:       httptest.NewRecorder(),
+			r:       fr,
+			timeout: time.Second,
+			exp:     true,
+		},
+		{
+			w:       httptest.NewRecorder(),
+			r:       fr,
+			timeout: 0,
+			exp:     false,
+		},
+	}
+
+	for _, c := range cases {
+		var got bool
+		fh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, got = r.Context().Deadline()
+		})
+
+		s.Deadline(fh, c.timeout).ServeHTTP(c.w, c.r)
+		if got != c.exp {
+			t.Errorf("Deadline expected: %v, got: %v", c.exp, got)
+		}
+	}
+}
+
 func TestServerLogger(t *testing.T) {
 	lm, hook := test.NewNullLogger()
 	fr, err := http.NewRequest("GET", "/", nil)
@@ -406,7 +528,7 @@ func TestServerLogger(t *testing.T) {
 
 	s := Server{Log: lm}
 	fh := FakeHandler{false}
-	logFunc, ok := s.Logger(fh).(http.HandlerFunc)
+	logFunc, ok := s.Logger(fh, Route{Service: "test", Name: "test"}).(http.HandlerFunc)
 	if !ok {
 		t.Fatal("Logger did not return expected handler function")
 	}
@@ -437,6 +559,54 @@ func TestServerLogger(t *testing.T) {
 	}
 }
 
+func TestServerLoggerFields(t *testing.T) {
+	lm, hook := test.NewNullLogger()
+	s := Server{Log: lm}
+	fh := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetRequestInfo(r.Context()).User = "test"
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("test"))
+	})
+
+	cases := []struct {
+		id    string
+		expID bool
+	}{
+		{id: "inbound-id", expID: true},
+		{id: "", expID: false},
+	}
+
+	for _, c := range cases {
+		fr, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		fr.Header.Set(RequestIDHeader, c.id)
+		w := httptest.NewRecorder()
+		s.Logger(fh, Route{Service: "dapi", Name: "index"}).ServeHTTP(w, fr)
+		id := w.Header().Get(RequestIDHeader)
+		if id == "" || (c.expID && id != c.id) {
+			t.Errorf("Request ID expected: %v, got: %v", c.id, id)
+		}
+
+		exp := logrus.Fields{
+			"status":     http.StatusCreated,
+			"size":       4,
+			"route":      "index",
+			"service":    "dapi",
+			"user":       "test",
+			"request_id": id,
+		}
+
+		for k, v := range exp {
+			if hook.LastEntry().Data[k] != v {
+				t.Errorf("Field %v expected: %v, got: %v", k, v, hook.LastEntry().Data[k])
+			}
+		}
+	}
+}
+
 func TestServerRespondWithError(t *testing.T) {
 	fr, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -448,19 +618,26 @@ func TestServerRespondWithError(t *testing.T) {
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
+		err     error
 		expCode int
 		expBody string
 	}{
 		{
 			w:       httptest.NewRecorder(),
 			r:       fr,
+			err:     dlib.NewError(http.StatusInternalServerError, "testerror"),
 			expCode: http.StatusInternalServerError,
 		},
+		{
+			w:       httptest.NewRecorder(),
+			r:       fr,
+			err:     context.DeadlineExceeded,
+			expCode: http.StatusGatewayTimeout,
+		},
 	}
 
 	for _, c := range cases {
-		svr.RespondWithError(dlib.NewError(
-			http.StatusInternalServerError, "testerror"), c.w, c.r)
+		svr.RespondWithError(c.err, c.w, c.r)
 		if c.w.Code != c.expCode {
 			t.Errorf("Code expected: %v, got: %v", c.expCode, c.w.Code)
 		}
@@ -3,10 +3,9 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
+	"net/url"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/timestamp"
@@ -17,302 +16,63 @@ import (
 	"github.com/gorilla/mux"
 )
 
-// GetTokens is the get handler function for tokens.
-func (s *Server) GetTokens(w http.ResponseWriter, r *http.Request) {
-	var data []dauth.Token
-	q := dauth.Token{}
-	if len(r.URL.Query()) != 0 {
-		if err := q.FromQueryValues(r.URL.Query()); err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-	}
-
-	req := q.ToRequest()
-	stream, err := s.Auth.GetTokens(context.Background(), &req)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			if len(data) == 0 {
-				s.RespondNotFound(w, r)
-				return
-			}
-
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(data); err != nil {
-				s.Log.Error(err)
-			}
-
-			return
-		}
-
-		if err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-
-		v := dauth.Token{}
-		err = v.FromResponse(res)
-		if err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-
-		data = append(data, v)
-	}
-}
-
-// GetTokenByID is the get by id handler function for tokens.
-func (s *Server) GetTokenByID(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
-	if err != nil {
-		s.RespondWithError(dlib.NewError(http.StatusBadRequest,
-			"invalid id value"), w, r)
-		return
-	}
-
-	var v *dauth.Token
-	req := ptypes.TokenRequest{ID: id}
-	stream, err := s.Auth.GetTokens(context.Background(), &req)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			if v == nil {
-				s.RespondNotFound(w, r)
-				return
+// Tokens returns the tokens resource. Tokens are last modified when they are
+// created.
+func (s *Server) Tokens() *Resource[dauth.Token, ptypes.TokenRequest, ptypes.TokenResponse] {
+	return &Resource[dauth.Token, ptypes.TokenRequest, ptypes.TokenResponse]{
+		Server:  s,
+		Service: "dauth",
+		Name:    "Tokens",
+		Path:    "/dauth/tokens",
+		Noun:    "Token",
+		Nouns:   "Tokens",
+		Schema:  TokenSchema,
+		Fetch: func(ctx context.Context,
+			req *ptypes.TokenRequest) (RecvStream[ptypes.TokenResponse], error) {
+			return s.Auth.GetTokens(ctx, req)
+		},
+		Save: func(ctx context.Context) (SaveStream[ptypes.TokenRequest, ptypes.TokenResponse], error) {
+			return s.Auth.SaveTokens(ctx)
+		},
+		Remove: func(ctx context.Context, req *ptypes.TokenRequest) (int64, error) {
+			res, err := s.Auth.DeleteTokens(ctx, req)
+			if err != nil {
+				return 0, err
 			}
 
-			w.WriteHeader(http.StatusOK)
-			if err := json.NewEncoder(w).Encode(v); err != nil {
-				s.Log.Error(err)
+			return res.Num, nil
+		},
+		ToRequest: func(v *dauth.Token) ptypes.TokenRequest {
+			return v.ToRequest()
+		},
+		FromResponse: func(v *dauth.Token, res *ptypes.TokenResponse) error {
+			return v.FromResponse(res)
+		},
+		FromQuery: func(v *dauth.Token, vals url.Values) error {
+			return v.FromQueryValues(vals)
+		},
+		SetID: func(v *dauth.Token, id int64) {
+			v.ID = id
+		},
+		Modified: func(v *dauth.Token) time.Time {
+			if v.Created == nil {
+				return time.Time{}
 			}
 
-			return
-		}
-
-		if err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-
-		v = new(dauth.Token)
-		err = v.FromResponse(res)
-		if err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-	}
-}
-
-// PostTokens is the post handler function for tokens.
-func (s *Server) PostTokens(w http.ResponseWriter, r *http.Request) {
-	dec := json.NewDecoder(r.Body)
-	vals := []dauth.Token{}
-	err := dec.Decode(&vals)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	defer r.Body.Close()
-	stream, err := s.Auth.SaveTokens(context.Background())
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	data := []dauth.Token{}
-	count := 0
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		for {
-			res, err := stream.Recv()
-			if err != nil {
-				if err != io.EOF {
-					s.RespondWithError(err, w, r)
+			return *v.Created
+		},
+		Invalidate: func(vals ...dauth.Token) {
+			for _, v := range vals {
+				if v.Token == "" {
+					s.AuthCache.Purge()
+					return
 				}
-
-				wg.Done()
-				return
 			}
 
-			v := dauth.Token{}
-			v.FromResponse(res)
-			count++
-			data = append(data, v)
-		}
-	}()
-
-	for _, v := range vals {
-		req := v.ToRequest()
-		if err := stream.Send(&req); err != nil {
-			s.RespondWithError(err, w, r)
-			return
-		}
-	}
-
-	err = stream.CloseSend()
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	wg.Wait()
-	res := dlib.Result{
-		Msg:  "Tokens saved",
-		Num:  count,
-		Data: data,
-	}
-
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		s.Log.Error(err)
-	}
-}
-
-// PutTokenByID is the put handler function for tokens.
-func (s *Server) PutTokenByID(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
-	if err != nil {
-		s.RespondWithError(dlib.NewError(http.StatusBadRequest,
-			"invalid id value"), w, r)
-		return
-	}
-
-	dec := json.NewDecoder(r.Body)
-	var v dauth.Token
-	err = dec.Decode(&v)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	defer r.Body.Close()
-	stream, err := s.Auth.SaveTokens(context.Background())
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	var val dauth.Token
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		for {
-			res, err := stream.Recv()
-			if err != nil {
-				if err != io.EOF {
-					s.RespondWithError(err, w, r)
-				}
-
-				wg.Done()
-				return
+			for _, v := range vals {
+				s.AuthCache.InvalidateToken(v.Token)
 			}
-
-			val.FromResponse(res)
-		}
-	}()
-
-	v.ID = id
-	req := v.ToRequest()
-	if err := stream.Send(&req); err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	err = stream.CloseSend()
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	wg.Wait()
-	res := dlib.Result{
-		Msg: "Token saved",
-		Num: 1,
-		Val: &val,
-	}
-
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		s.Log.Error(err)
-	}
-}
-
-// DeleteTokens is the delete handler function for tokens.
-func (s *Server) DeleteTokens(w http.ResponseWriter, r *http.Request) {
-	dec := json.NewDecoder(r.Body)
-	var q dauth.Token
-	err := dec.Decode(&q)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	defer r.Body.Close()
-	req := q.ToRequest()
-	dres, err := s.Auth.DeleteTokens(context.Background(), &req)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	if dres.Num == 0 {
-		s.RespondNotFound(w, r)
-		return
-	}
-
-	res := dlib.Result{
-		Msg: "Tokens deleted",
-		Num: int(dres.Num),
-	}
-
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		s.Log.Error(err)
-	}
-}
-
-// DeleteTokenByID is the delete by id handler function for tokens.
-func (s *Server) DeleteTokenByID(w http.ResponseWriter, r *http.Request) {
-	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
-	if err != nil {
-		s.RespondWithError(dlib.NewError(http.StatusBadRequest,
-			"invalid id value"), w, r)
-		return
-	}
-
-	req := ptypes.TokenRequest{ID: id}
-	dres, err := s.Auth.DeleteTokens(context.Background(), &req)
-	if err != nil {
-		s.RespondWithError(err, w, r)
-		return
-	}
-
-	if dres.Num == 0 {
-		s.RespondNotFound(w, r)
-		return
-	}
-
-	res := dlib.Result{
-		Msg: "Token deleted",
-		Num: int(dres.Num),
-	}
-
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(res); err != nil {
-		s.Log.Error(err)
+		},
 	}
 }
 
@@ -332,12 +92,17 @@ func (s *Server) DeleteTokensOld(w http.ResponseWriter, r *http.Request) {
 	}
 
 	req := ptypes.TokenRequest{Old: &old}
-	dres, err := s.Auth.DeleteTokens(context.Background(), &req)
-	if err != nil {
+	var dres *ptypes.DeleteResponse
+	if err := s.Call(r.Context(), func(ctx context.Context) error {
+		var err error
+		dres, err = s.Auth.DeleteTokens(ctx, &req)
+		return err
+	}); err != nil {
 		s.RespondWithError(err, w, r)
 		return
 	}
 
+	s.AuthCache.Purge()
 	if dres.Num == 0 {
 		s.RespondNotFound(w, r)
 		return
@@ -20,7 +20,7 @@ func TestServerGetTokens(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/tokens").HandlerFunc(svr.GetTokens)
+	rtr.Methods("GET").Path("/dauth/tokens").HandlerFunc(svr.Tokens().Get)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -58,7 +58,7 @@ func TestGetTokenByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/tokens/{id}").HandlerFunc(svr.GetTokenByID)
+	rtr.Methods("GET").Path("/dauth/tokens/{id}").HandlerFunc(svr.Tokens().GetByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -87,7 +87,7 @@ func TestGetTokenByID(t *testing.T) {
 }
 
 func TestPostTokens(t *testing.T) {
-	jbs := []byte("[{\"id\":1}]\n")
+	jbs := []byte("[{\"id\":1,\"user_id\":1}]\n")
 	fr, err := http.NewRequest("POST", "/dauth/tokens", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -97,7 +97,7 @@ func TestPostTokens(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("POST").Path("/dauth/tokens").HandlerFunc(svr.PostTokens)
+	rtr.Methods("POST").Path("/dauth/tokens").HandlerFunc(svr.Tokens().Post)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -108,7 +108,7 @@ func TestPostTokens(t *testing.T) {
 			w:       httptest.NewRecorder(),
 			r:       fr,
 			expCode: http.StatusOK,
-			expBody: `{"number":1,"message":"Tokens saved","data":[{"id":1,"token":"test"}]}` + "\n",
+			expBody: `{"number":1,"message":"Tokens saved","data":[{"index":0,"status":200,"value":{"id":1,"token":"test"}}]}` + "\n",
 		},
 	}
 
@@ -126,7 +126,7 @@ func TestPostTokens(t *testing.T) {
 }
 
 func TestPutTokenByID(t *testing.T) {
-	jbs := []byte("{\"id\":1}\n")
+	jbs := []byte("{\"id\":1,\"user_id\":1}\n")
 	fr, err := http.NewRequest("PUT", "/dauth/tokens/1", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -136,7 +136,7 @@ func TestPutTokenByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("PUT").Path("/dauth/tokens/{id}").HandlerFunc(svr.PutTokenByID)
+	rtr.Methods("PUT").Path("/dauth/tokens/{id}").HandlerFunc(svr.Tokens().PutByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -175,7 +175,7 @@ func TestDeleteTokens(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/tokens").HandlerFunc(svr.DeleteTokens)
+	rtr.Methods("DELETE").Path("/dauth/tokens").HandlerFunc(svr.Tokens().Delete)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -213,7 +213,7 @@ func TestDeleteTokenByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/tokens/{id}").HandlerFunc(svr.DeleteTokenByID)
+	rtr.Methods("DELETE").Path("/dauth/tokens/{id}").HandlerFunc(svr.Tokens().DeleteByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
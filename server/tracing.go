@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dhaifley/dapi/lib"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TracerName is the instrumentation name used for the server spans.
+const TracerName = "github.com/dhaifley/dapi/server"
+
+// TraceConfig values configure the exporting of trace spans.
+// Exporter is one of "otlp", "stdout" or "file". Endpoint is the address of
+// the OTLP collector and Path is the file spans are written to.
+type TraceConfig struct {
+	Exporter string
+	Endpoint string
+	Insecure bool
+	Path     string
+}
+
+// NewTracerProvider creates and returns a tracer provider which exports spans
+// as configured. The returned function flushes and stops the provider.
+func NewTracerProvider(ctx context.Context, cfg TraceConfig) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var f *os.File
+	var err error
+	switch cfg.Exporter {
+	case "otlp":
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		exp, err = otlptracegrpc.New(ctx, opts...)
+	case "stdout":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "file":
+		f, err = os.OpenFile(cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	default:
+		return nil, nil, errors.New("unsupported trace exporter: " + cfg.Exporter)
+	}
+
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+
+		return nil, nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", lib.ServiceInfo.Name),
+			attribute.String("service.version", lib.ServiceInfo.Version),
+		)),
+	)
+
+	shutdown := func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if f != nil {
+			if ferr := f.Close(); err == nil {
+				err = ferr
+			}
+		}
+
+		return err
+	}
+
+	return tp, shutdown, nil
+}
+
+// startSpan starts a span when tracing is enabled. A non-recording span is
+// returned when it is not.
+func (s *Server) startSpan(ctx context.Context, name string,
+	opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if s.Tracing == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	return s.Tracing.Tracer(TracerName).Start(ctx, name, opts...)
+}
+
+// endSpan records any error on a span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Trace wraps a handler function with a span for the request. A W3C trace
+// context sent by the client is continued.
+func (s *Server) Trace(handler http.Handler, route Route) http.Handler {
+	if s.Tracing == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagation.TraceContext{}.Extract(r.Context(),
+			propagation.HeaderCarrier(r.Header))
+		ctx, span := s.startSpan(ctx, route.Service+"."+route.Name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+				attribute.String("dapi.route", route.Name),
+				attribute.String("dapi.service", route.Service),
+			))
+		defer span.End()
+		if ri := GetRequestInfo(ctx); ri != nil {
+			span.SetAttributes(attribute.String("dapi.request_id", ri.ID))
+		}
+
+		rw := &responseWriter{ResponseWriter: w}
+		handler.ServeHTTP(rw, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.status_code", rw.Status()))
+		if rw.Status() >= http.StatusInternalServerError {
+			span.SetStatus(otelcodes.Error, http.StatusText(rw.Status()))
+		}
+	})
+}
+
+// metadataCarrier adapts gRPC metadata for use with trace propagators.
+type metadataCarrier metadata.MD
+
+// Get returns the first value for a key.
+func (mc metadataCarrier) Get(key string) string {
+	v := metadata.MD(mc).Get(key)
+	if len(v) == 0 {
+		return ""
+	}
+
+	return v[0]
+}
+
+// Set sets the value for a key.
+func (mc metadataCarrier) Set(key, value string) {
+	metadata.MD(mc).Set(key, value)
+}
+
+// Keys returns all keys in the metadata.
+func (mc metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(mc))
+	for k := range mc {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// injectTraceContext returns a copy of the context with the W3C trace context
+// of its span attached as outgoing gRPC metadata.
+func injectTraceContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	propagation.TraceContext{}.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// rpcSpanOptions returns the span options for a gRPC call.
+func rpcSpanOptions(method string) []trace.SpanStartOption {
+	parts := strings.SplitN(strings.TrimPrefix(method, "/"), "/", 2)
+	attrs := []attribute.KeyValue{attribute.String("rpc.system", "grpc")}
+	if len(parts) == 2 {
+		attrs = append(attrs,
+			attribute.String("rpc.service", parts[0]),
+			attribute.String("rpc.method", parts[1]))
+	}
+
+	return []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	}
+}
+
+// TraceUnaryClientInterceptor creates spans for unary gRPC calls and
+// propagates their trace context to the backend service.
+func (s *Server) TraceUnaryClientInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, span := s.startSpan(ctx, strings.TrimPrefix(method, "/"), rpcSpanOptions(method)...)
+	err := invoker(injectTraceContext(ctx), method, req, reply, cc, opts...)
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	endSpan(span, err)
+	return err
+}
+
+// TraceStreamClientInterceptor creates spans for streaming gRPC calls and
+// propagates their trace context to the backend service. Spans end when the
+// streams finish, which includes streams abandoned by canceling their context.
+func (s *Server) TraceStreamClientInterceptor(ctx context.Context, desc *grpc.StreamDesc,
+	cc *grpc.ClientConn, method string, streamer grpc.Streamer,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx, span := s.startSpan(ctx, strings.TrimPrefix(method, "/"), rpcSpanOptions(method)...)
+	done := finishOnce(func(err error) {
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+		endSpan(span, err)
+	})
+
+	cs, err := streamer(injectTraceContext(ctx), desc, cc, method,
+		append(opts, grpc.OnFinish(done))...)
+	if err != nil {
+		done(err)
+		return nil, err
+	}
+
+	return cs, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestServerTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traces.json")
+	tp, shutdown, err := NewTracerProvider(context.Background(),
+		TraceConfig{Exporter: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fc := FakeAuthClient{}
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &fc, Log: lm, Tracing: tp}
+	route := Route{Service: "dauth", Name: "GetUsers"}
+	h := svr.Trace(svr.AuthHandler(http.HandlerFunc(svr.Users().Get),
+		&dauth.Perm{Service: route.Service, Name: route.Name}), route)
+	fr, err := http.NewRequest("GET", "/dauth/users", nil)
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	fr.Header.Set("Token", "test")
+	fr.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), fr)
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	if err := svr.TraceUnaryClientInterceptor(context.Background(),
+		"/ptypes.Auth/Login", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(md.Get("traceparent")) != 1 {
+		t.Errorf("Trace context expected in metadata, got: %v", md)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		exp string
+	}{
+		{exp: `"Name":"dauth.GetUsers"`},
+		{exp: `"Name":"CheckAuth"`},
+		{exp: `"Name":"ptypes.Auth/Login"`},
+		{exp: `"TraceID":"4bf92f3577b34da6a3ce929d0e0e4736"`},
+	}
+
+	for _, c := range cases {
+		if !strings.Contains(string(b), c.exp) {
+			t.Errorf("Traces expected to contain: %v, got: %v", c.exp, string(b))
+		}
+	}
+}
+
+func TestStreamClientInterceptorsCanceled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "traces.json")
+	tp, shutdown, err := NewTracerProvider(context.Background(),
+		TraceConfig{Exporter: "file", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, Tracing: tp, Metrics: NewMetrics()}
+	conn, files, stop := NewTestBackendServer(t,
+		grpc.WithChainStreamInterceptor(svr.TraceStreamClientInterceptor,
+			svr.Metrics.StreamClientInterceptor))
+	defer stop()
+	md, err := findMethod(files, "test.Widgets/ListWidgets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method := fullMethod(md)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.SendMsg(dynamicpb.NewMessage(md.Input())); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stream.RecvMsg(dynamicpb.NewMessage(md.Output())); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	var got float64
+	for i := 0; i < 100; i++ {
+		got = testutil.ToFloat64(svr.Metrics.RPCRequests.WithLabelValues(method, "Canceled"))
+		if got == 1 {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got != 1 {
+		t.Errorf("Canceled streams expected: %v, got: %v", 1, got)
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(b), `"Name":"test.Widgets/ListWidgets"`) {
+		t.Errorf("Traces expected to contain: %v, got: %v", method, string(b))
+	}
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// transcodeJSON contains the options used to write backend messages as JSON.
+// Field names are written as they are in the proto files.
+var transcodeJSON = protojson.MarshalOptions{UseProtoNames: true}
+
+// findField returns the descriptor of a field of a message, named by its
+// proto or JSON name. Fields of nested messages are named with dotted paths.
+func findField(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	fds := []protoreflect.FieldDescriptor{}
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(name)
+		}
+
+		if fd == nil {
+			return nil, fmt.Errorf("unknown field: %s", path)
+		}
+
+		fds = append(fds, fd)
+		if i == len(names)-1 {
+			break
+		}
+
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return nil, fmt.Errorf("field %s has no fields", strings.Join(names[:i+1], "."))
+		}
+
+		md = fd.Message()
+	}
+
+	fd := fds[len(fds)-1]
+	if fd.IsMap() || fd.Kind() == protoreflect.MessageKind ||
+		fd.Kind() == protoreflect.GroupKind {
+		return nil, fmt.Errorf("field %s cannot be set from a parameter", path)
+	}
+
+	return fds, nil
+}
+
+// parseValue parses a parameter value for a field.
+func parseValue(fd protoreflect.FieldDescriptor, v string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(v)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(v, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(v, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(v, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(v, 32)
+		if err == nil && math.IsInf(f, 0) {
+			err = strconv.ErrRange
+		}
+
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(v, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(v), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(v)
+		}
+
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(v)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+
+		n, err := strconv.ParseInt(v, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported field type %s", fd.Kind())
+}
+
+// setField sets a field of a message, named by its proto or JSON name, from
+// parameter values. Repeated fields are set to all of the values, and other
+// fields to the last one.
+func setField(m protoreflect.Message, path string, vals []string) error {
+	fds, err := findField(m.Descriptor(), path)
+	if err != nil {
+		return NewProblem(ErrBadRequest, err.Error())
+	}
+
+	for _, fd := range fds[:len(fds)-1] {
+		m = m.Mutable(fd).Message()
+	}
+
+	fd := fds[len(fds)-1]
+	if fd.IsList() {
+		l := m.Mutable(fd).List()
+		for _, v := range vals {
+			pv, err := parseValue(fd, v)
+			if err != nil {
+				return validationProblem(FieldError{Field: path, Message: "invalid value: " + v})
+			}
+
+			l.Append(pv)
+		}
+
+		return nil
+	}
+
+	if len(vals) == 0 {
+		return nil
+	}
+
+	v := vals[len(vals)-1]
+	pv, err := parseValue(fd, v)
+	if err != nil {
+		return validationProblem(FieldError{Field: path, Message: "invalid value: " + v})
+	}
+
+	m.Set(fd, pv)
+	return nil
+}
+
+// decodeMessageBody decodes a backend request message from the JSON body of
+// an HTTP request, when there is one.
+func (s *Server) decodeMessageBody(w http.ResponseWriter, r *http.Request, m protoreflect.Message) error {
+	if r.Body == nil {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(s.limitBody(w, r))
+	if err != nil {
+		return decodeError(err)
+	}
+
+	defer r.Body.Close()
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := protojson.Unmarshal(body, m.Interface()); err != nil {
+			return NewProblem(ErrBadRequest, "invalid request body: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// DecodeMessage decodes a backend request message from an HTTP request. The
+// JSON body, when there is one, is read first, then the query parameters and
+// the path variables each set the fields with the same names.
+func (s *Server) DecodeMessage(w http.ResponseWriter, r *http.Request, m protoreflect.Message) error {
+	if err := s.decodeMessageBody(w, r, m); err != nil {
+		return err
+	}
+
+	for k, vals := range r.URL.Query() {
+		if err := setField(m, k, vals); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range mux.Vars(r) {
+		if err := setField(m, k, []string{v}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transcode returns the handler function which calls a backend method. The
+// request message is decoded from the HTTP request, and the response message
+// is written as JSON. The messages of server streaming methods are written as
+// a list.
+func (s *Server) Transcode(b *Backend, md protoreflect.MethodDescriptor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		in := dynamicpb.NewMessage(md.Input())
+		if err := s.DecodeMessage(w, r, in); err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		s.invoke(w, r, b, md, in)
+	}
+}
+
+// invoke calls a backend method and responds with its response messages.
+func (s *Server) invoke(w http.ResponseWriter, r *http.Request, b *Backend,
+	md protoreflect.MethodDescriptor, in proto.Message) {
+	method := fullMethod(md)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if !md.IsStreamingServer() {
+		out := dynamicpb.NewMessage(md.Output())
+		if err := b.Conn.Invoke(ctx, method, in, out); err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		data, err := transcodeJSON.Marshal(out)
+		if err != nil {
+			s.RespondWithError(err, w, r)
+			return
+		}
+
+		s.RespondWithResource(w, r, json.RawMessage(data), time.Time{})
+		return
+	}
+
+	stream, err := b.Conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method)
+	if err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if err := stream.SendMsg(in); err != nil && err != io.EOF {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		s.RespondWithError(err, w, r)
+		return
+	}
+
+	s.RespondWithList(w, r, ListOptions{}, func() (interface{}, error) {
+		out := dynamicpb.NewMessage(md.Output())
+		if err := stream.RecvMsg(out); err != nil {
+			return nil, err
+		}
+
+		data, err := transcodeJSON.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+
+		return json.RawMessage(data), nil
+	})
+}
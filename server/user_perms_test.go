@@ -20,7 +20,7 @@ func TestServerGetUserPerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/userperms").HandlerFunc(svr.GetUserPerms)
+	rtr.Methods("GET").Path("/dauth/userperms").HandlerFunc(svr.UserPerms().Get)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -58,7 +58,7 @@ func TestGetUserPermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/userperms/{id}").HandlerFunc(svr.GetUserPermByID)
+	rtr.Methods("GET").Path("/dauth/userperms/{id}").HandlerFunc(svr.UserPerms().GetByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -87,7 +87,7 @@ func TestGetUserPermByID(t *testing.T) {
 }
 
 func TestPostUserPerms(t *testing.T) {
-	jbs := []byte("[{\"id\":1}]\n")
+	jbs := []byte("[{\"id\":1,\"user_id\":1,\"perm_id\":1}]\n")
 	fr, err := http.NewRequest("POST", "/dauth/userperms", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -97,7 +97,7 @@ func TestPostUserPerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("POST").Path("/dauth/userperms").HandlerFunc(svr.PostUserPerms)
+	rtr.Methods("POST").Path("/dauth/userperms").HandlerFunc(svr.UserPerms().Post)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -108,7 +108,7 @@ func TestPostUserPerms(t *testing.T) {
 			w:       httptest.NewRecorder(),
 			r:       fr,
 			expCode: http.StatusOK,
-			expBody: `{"number":1,"message":"User permissions saved","data":[{"id":1,"user_id":1,"perm_id":1}]}` + "\n",
+			expBody: `{"number":1,"message":"User permissions saved","data":[{"index":0,"status":200,"value":{"id":1,"user_id":1,"perm_id":1}}]}` + "\n",
 		},
 	}
 
@@ -126,7 +126,7 @@ func TestPostUserPerms(t *testing.T) {
 }
 
 func TestPutUserPermByID(t *testing.T) {
-	jbs := []byte("{\"id\":1}\n")
+	jbs := []byte("{\"id\":1,\"user_id\":1,\"perm_id\":1}\n")
 	fr, err := http.NewRequest("PUT", "/dauth/userperms/1", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -136,7 +136,7 @@ func TestPutUserPermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("PUT").Path("/dauth/userperms/{id}").HandlerFunc(svr.PutUserPermByID)
+	rtr.Methods("PUT").Path("/dauth/userperms/{id}").HandlerFunc(svr.UserPerms().PutByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -175,7 +175,7 @@ func TestDeleteUserPerms(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/userperms").HandlerFunc(svr.DeleteUserPerms)
+	rtr.Methods("DELETE").Path("/dauth/userperms").HandlerFunc(svr.UserPerms().Delete)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -213,7 +213,7 @@ func TestDeleteUserPermByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/userperms/{id}").HandlerFunc(svr.DeleteUserPermByID)
+	rtr.Methods("DELETE").Path("/dauth/userperms/{id}").HandlerFunc(svr.UserPerms().DeleteByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
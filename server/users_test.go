@@ -20,7 +20,7 @@ func TestServerGetUsers(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/users").HandlerFunc(svr.GetUsers)
+	rtr.Methods("GET").Path("/dauth/users").HandlerFunc(svr.Users().Get)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -58,7 +58,7 @@ func TestGetUserByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("GET").Path("/dauth/users/{id}").HandlerFunc(svr.GetUserByID)
+	rtr.Methods("GET").Path("/dauth/users/{id}").HandlerFunc(svr.Users().GetByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -87,7 +87,7 @@ func TestGetUserByID(t *testing.T) {
 }
 
 func TestPostUsers(t *testing.T) {
-	jbs := []byte("[{\"id\":1}]\n")
+	jbs := []byte("[{\"id\":1,\"user\":\"test\"}]\n")
 	fr, err := http.NewRequest("POST", "/dauth/users", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -97,7 +97,7 @@ func TestPostUsers(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("POST").Path("/dauth/users").HandlerFunc(svr.PostUsers)
+	rtr.Methods("POST").Path("/dauth/users").HandlerFunc(svr.Users().Post)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -108,7 +108,7 @@ func TestPostUsers(t *testing.T) {
 			w:       httptest.NewRecorder(),
 			r:       fr,
 			expCode: http.StatusOK,
-			expBody: `{"number":1,"message":"Users saved","data":[{"id":1,"user":"test"}]}` + "\n",
+			expBody: `{"number":1,"message":"Users saved","data":[{"index":0,"status":200,"value":{"id":1,"user":"test"}}]}` + "\n",
 		},
 	}
 
@@ -126,7 +126,7 @@ func TestPostUsers(t *testing.T) {
 }
 
 func TestPutUserByID(t *testing.T) {
-	jbs := []byte("{\"id\":1}\n")
+	jbs := []byte("{\"id\":1,\"user\":\"test\"}\n")
 	fr, err := http.NewRequest("PUT", "/dauth/users/1", bytes.NewBuffer(jbs))
 	if err != nil {
 		t.Fatal("Failed to initialize request", err)
@@ -136,7 +136,7 @@ func TestPutUserByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("PUT").Path("/dauth/users/{id}").HandlerFunc(svr.PutUserByID)
+	rtr.Methods("PUT").Path("/dauth/users/{id}").HandlerFunc(svr.Users().PutByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -175,7 +175,7 @@ func TestDeleteUsers(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/users").HandlerFunc(svr.DeleteUsers)
+	rtr.Methods("DELETE").Path("/dauth/users").HandlerFunc(svr.Users().Delete)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -213,7 +213,7 @@ func TestDeleteUserByID(t *testing.T) {
 	lm, _ := test.NewNullLogger()
 	svr := Server{Auth: &fc, Log: lm}
 	rtr := mux.NewRouter()
-	rtr.Methods("DELETE").Path("/dauth/users/{id}").HandlerFunc(svr.DeleteUserByID)
+	rtr.Methods("DELETE").Path("/dauth/users/{id}").HandlerFunc(svr.Users().DeleteByID)
 	cases := []struct {
 		w       *httptest.ResponseRecorder
 		r       *http.Request
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule values describe the constraints on a request body field. Required
+// fields must not have their zero value, and MaxLen limits the number of
+// characters in string fields. Format names a string format such as "email".
+type Rule struct {
+	Required bool
+	MaxLen   int
+	Format   string
+}
+
+// Schema values describe the constraints on the fields of a request body,
+// keyed by JSON field name.
+type Schema map[string]Rule
+
+// Request body schemas.
+var (
+	UserSchema = Schema{
+		"user":  {Required: true, MaxLen: 64},
+		"pass":  {MaxLen: 128},
+		"name":  {MaxLen: 128},
+		"email": {MaxLen: 254, Format: "email"},
+	}
+	LoginSchema = Schema{
+		"user": {Required: true, MaxLen: 64},
+		"pass": {Required: true, MaxLen: 128},
+	}
+	TokenSchema = Schema{
+		"token":   {MaxLen: 256},
+		"user_id": {Required: true},
+	}
+	LogoutSchema = Schema{
+		"token": {Required: true, MaxLen: 256},
+	}
+	PermSchema = Schema{
+		"service": {Required: true, MaxLen: 64},
+		"name":    {Required: true, MaxLen: 128},
+	}
+	UserPermSchema = Schema{
+		"user_id": {Required: true},
+		"perm_id": {Required: true},
+	}
+)
+
+// formats contains the string format checks used by schema rules.
+var formats = map[string]func(string) bool{
+	"email": func(v string) bool {
+		a, err := mail.ParseAddress(v)
+		return err == nil && a.Address == v
+	},
+}
+
+// check returns an error if the schema has rules for fields which values of
+// a type do not have.
+func (sc Schema) check(t reflect.Type) error {
+	fields := NewFields(reflect.Zero(t).Interface())
+	unknown := []string{}
+	for name := range sc {
+		if _, ok := fields.index[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("schema fields not found in %v: %s", t,
+		strings.Join(unknown, ", "))
+}
+
+// Validate checks a value, or each element of a slice of values, against
+// the schema and returns the errors for any invalid fields. An error is
+// returned if the schema has rules for fields the values do not have.
+func (sc Schema) Validate(v interface{}) ([]FieldError, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() == reflect.Slice {
+		if err := sc.check(rv.Type().Elem()); err != nil {
+			return nil, err
+		}
+
+		errs := []FieldError{}
+		for i := 0; i < rv.Len(); i++ {
+			fes, err := sc.Validate(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+
+			for _, fe := range fes {
+				fe.Field = "[" + strconv.Itoa(i) + "]." + fe.Field
+				errs = append(errs, fe)
+			}
+		}
+
+		return errs, nil
+	}
+
+	if err := sc.check(rv.Type()); err != nil {
+		return nil, err
+	}
+
+	errs := []FieldError{}
+	fields := NewFields(rv.Interface())
+	for _, name := range fields.Names {
+		rule, ok := sc[name]
+		if !ok {
+			continue
+		}
+
+		fv := fields.value(rv.Interface(), name)
+		if !fv.IsValid() || fv.IsZero() {
+			if rule.Required {
+				errs = append(errs, FieldError{Field: name, Message: "is required"})
+			}
+
+			continue
+		}
+
+		if fv.Kind() != reflect.String {
+			continue
+		}
+
+		if rule.MaxLen > 0 && utf8.RuneCountInString(fv.String()) > rule.MaxLen {
+			errs = append(errs, FieldError{Field: name,
+				Message: fmt.Sprintf("must be at most %d characters", rule.MaxLen)})
+			continue
+		}
+
+		if check, ok := formats[rule.Format]; ok && !check(fv.String()) {
+			errs = append(errs, FieldError{Field: name,
+				Message: "must be a valid " + rule.Format})
+		}
+	}
+
+	return errs, nil
+}
+
+// validationProblem returns the problem for a list of field errors.
+func validationProblem(errs ...FieldError) *Problem {
+	p := NewProblem(ErrValidation, "invalid request body")
+	p.Errors = errs
+	return p
+}
+
+// unknownFieldPrefix begins the errors returned by the JSON decoder for
+// unknown fields. The decoder does not export a type for these errors.
+const unknownFieldPrefix = "json: unknown field "
+
+// unknownField returns the name of the field of an unknown field error
+// returned by the JSON decoder.
+func unknownField(err error) (string, bool) {
+	if !strings.HasPrefix(err.Error(), unknownFieldPrefix) {
+		return "", false
+	}
+
+	return strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`), true
+}
+
+// decodeError returns the problem for an error decoding a request body.
+func decodeError(err error) error {
+	var mbe *http.MaxBytesError
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	if name, ok := unknownField(err); ok {
+		return validationProblem(FieldError{Field: name, Message: "is not a known field"})
+	}
+
+	switch {
+	case err == io.EOF:
+		return NewProblem(ErrBadRequest, "request body is required")
+	case errors.As(err, &mbe):
+		return NewProblem(ErrPayloadTooLarge, fmt.Sprintf(
+			"request body must be at most %d bytes", mbe.Limit))
+	case errors.As(err, &se):
+		return NewProblem(ErrBadRequest, fmt.Sprintf(
+			"invalid JSON at offset %d", se.Offset))
+	case errors.As(err, &te):
+		return validationProblem(FieldError{Field: te.Field,
+			Message: "must be of type " + te.Type.String()})
+	case err == io.ErrUnexpectedEOF:
+		return NewProblem(ErrBadRequest, "invalid JSON")
+	}
+
+	return NewProblem(ErrBadRequest, err.Error())
+}
+
+// decodeStrict decodes a single JSON value into v, rejecting unknown fields
+// and any data after the value.
+func decodeStrict(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return decodeError(err)
+		}
+
+		return NewProblem(ErrBadRequest,
+			"request body must contain a single JSON value")
+	}
+
+	return nil
+}
+
+// limitBody limits the size of a request body to the server maximum.
+func (s *Server) limitBody(w http.ResponseWriter, r *http.Request) io.Reader {
+	if s.MaxBodySize <= 0 {
+		return r.Body
+	}
+
+	return http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+}
+
+// DecodeBody decodes a request body into v and validates it against a
+// schema, which may be nil. Bodies larger than the server maximum, unknown
+// fields and invalid fields are rejected.
+func (s *Server) DecodeBody(w http.ResponseWriter, r *http.Request, v interface{}, sc Schema) error {
+	if err := decodeStrict(s.limitBody(w, r), v); err != nil {
+		return err
+	}
+
+	errs, err := sc.Validate(v)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return validationProblem(errs...)
+	}
+
+	return nil
+}
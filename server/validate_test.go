@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dhaifley/dlib/dauth"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestServerDecodeBody(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Log: lm, MaxBodySize: 64}
+	cases := []struct {
+		body      string
+		expCode   string
+		expFields []string
+	}{
+		{body: `{"user":"test","email":"test@test.com"}`},
+		{body: ``, expCode: ErrBadRequest},
+		{body: `{"user":`, expCode: ErrBadRequest},
+		{body: `{"user":"test"} {}`, expCode: ErrBadRequest},
+		{body: `{"user":"test","admin":true}`, expCode: ErrValidation,
+			expFields: []string{"admin"}},
+		{body: `{"user":1}`, expCode: ErrValidation, expFields: []string{"user"}},
+		{body: `{"name":"test"}`, expCode: ErrValidation, expFields: []string{"user"}},
+		{body: `{"user":"test","email":"test"}`, expCode: ErrValidation,
+			expFields: []string{"email"}},
+		{body: `{"user":"` + strings.Repeat("a", 65) + `"}`, expCode: ErrPayloadTooLarge},
+	}
+
+	for _, c := range cases {
+		r, err := http.NewRequest("POST", "/dauth/users", bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal("Failed to initialize request", err)
+		}
+
+		v := dauth.User{}
+		err = svr.DecodeBody(httptest.NewRecorder(), r, &v, UserSchema)
+		if c.expCode == "" {
+			if err != nil {
+				t.Errorf("Error expected: %v, got: %v", nil, err)
+			}
+
+			continue
+		}
+
+		p, ok := err.(*Problem)
+		if !ok {
+			t.Fatalf("Problem expected, got: %v", err)
+		}
+
+		if p.Code != c.expCode {
+			t.Errorf("Code expected: %v, got: %v", c.expCode, p.Code)
+		}
+
+		if len(p.Errors) != len(c.expFields) {
+			t.Fatalf("Errors expected: %v, got: %v", len(c.expFields), len(p.Errors))
+		}
+
+		for i, f := range c.expFields {
+			if p.Errors[i].Field != f {
+				t.Errorf("Field expected: %v, got: %v", f, p.Errors[i].Field)
+			}
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	cases := []struct {
+		v         interface{}
+		expFields []string
+	}{
+		{v: &dauth.Perm{Service: "test", Name: "test"}},
+		{v: &dauth.Perm{}, expFields: []string{"service", "name"}},
+		{v: &dauth.Perm{Service: strings.Repeat("a", 65), Name: "test"},
+			expFields: []string{"service"}},
+		{v: &[]dauth.Perm{{Service: "test", Name: "test"}, {Service: "test"}},
+			expFields: []string{"[1].name"}},
+	}
+
+	for _, c := range cases {
+		errs, err := PermSchema.Validate(c.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(errs) != len(c.expFields) {
+			t.Fatalf("Errors expected: %v, got: %v", len(c.expFields), len(errs))
+		}
+
+		for i, f := range c.expFields {
+			if errs[i].Field != f {
+				t.Errorf("Field expected: %v, got: %v", f, errs[i].Field)
+			}
+		}
+	}
+}
+
+func TestSchemaValidateUnknown(t *testing.T) {
+	sc := Schema{"service": {Required: true}, "path": {}, "action": {}}
+	exp := "schema fields not found in dauth.Perm: action, path"
+	cases := []struct {
+		v interface{}
+	}{
+		{v: &dauth.Perm{Service: "test"}},
+		{v: &[]dauth.Perm{}},
+	}
+
+	for _, c := range cases {
+		_, err := sc.Validate(c.v)
+		if err == nil || err.Error() != exp {
+			t.Errorf("Error expected: %v, got: %v", exp, err)
+		}
+	}
+}
+
+func TestSchemasResolve(t *testing.T) {
+	cases := []struct {
+		name string
+		sc   Schema
+		v    interface{}
+	}{
+		{name: "UserSchema", sc: UserSchema, v: &dauth.User{}},
+		{name: "LoginSchema", sc: LoginSchema, v: &dauth.User{}},
+		{name: "TokenSchema", sc: TokenSchema, v: &dauth.Token{}},
+		{name: "LogoutSchema", sc: LogoutSchema, v: &dauth.Token{}},
+		{name: "PermSchema", sc: PermSchema, v: &dauth.Perm{}},
+		{name: "UserPermSchema", sc: UserPermSchema, v: &dauth.UserPerm{}},
+	}
+
+	for _, c := range cases {
+		if _, err := c.sc.Validate(c.v); err != nil {
+			t.Errorf("%s error expected: %v, got: %v", c.name, nil, err)
+		}
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	dec := json.NewDecoder(strings.NewReader(`{"id":1,"color":"red"}`))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&dauth.Perm{})
+	if err == nil {
+		t.Fatal("Error expected: unknown field, got: nil")
+	}
+
+	if name, ok := unknownField(err); !ok || name != "color" {
+		t.Errorf("Field expected: %v, got: %v %v (%v)", "color", name, ok, err)
+	}
+
+	if _, ok := unknownField(errors.New("invalid")); ok {
+		t.Errorf("Unknown field expected: %v, got: %v", false, ok)
+	}
+}
+
+func TestPostUsersInvalid(t *testing.T) {
+	lm, _ := test.NewNullLogger()
+	svr := Server{Auth: &FakeAuthClient{}, Log: lm}
+	r, err := http.NewRequest("POST", "/dauth/users",
+		bytes.NewBufferString(`[{"id":1,"user":"test"},{"id":2,"email":"test"}]`))
+	if err != nil {
+		t.Fatal("Failed to initialize request", err)
+	}
+
+	w := httptest.NewRecorder()
+	svr.Users().Post(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Code expected: %v, got: %v", http.StatusBadRequest, w.Code)
+	}
+
+	res := struct {
+		Code   int          `json:"code"`
+		Errors []FieldError `json:"errors"`
+	}{}
+
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []string{"[1].user", "[1].email"}
+	if len(res.Errors) != len(exp) {
+		t.Fatalf("Errors expected: %v, got: %v", len(exp), len(res.Errors))
+	}
+
+	for i, f := range exp {
+		if res.Errors[i].Field != f {
+			t.Errorf("Field expected: %v, got: %v", f, res.Errors[i].Field)
+		}
+	}
+}